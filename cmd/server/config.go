@@ -0,0 +1,379 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"calculator-otel/internal/app"
+	"calculator-otel/internal/cache"
+	"calculator-otel/internal/observability"
+	"calculator-otel/internal/storage"
+)
+
+type config struct {
+	storageBackend string
+	postgres       storage.Config
+	sqlitePath     string
+	memoryCapacity int
+	autoMigrate    bool
+
+	historyAsync         bool
+	historyQueueSize     int
+	historyBatchSize     int
+	historyFlushInterval time.Duration
+	historyOverflow      string
+	historyDrainTimeout  time.Duration
+	historyJournalPath   string
+	historyReplay        time.Duration
+
+	partitionMaintenance bool
+	partitionInterval    string
+	partitionPremake     int
+	partitionCheck       time.Duration
+	historyRetention     time.Duration
+
+	cacheTTL            time.Duration
+	cacheJitter         float64
+	cacheMinComputeCost time.Duration
+	cacheRules          string
+
+	adminAddr      string
+	trustedProxies app.TrustedProxies
+
+	cacheBreakerFailures    int
+	cacheBreakerOpenTimeout time.Duration
+	cacheBreakerProbes      int
+	cacheCallTimeout        time.Duration
+
+	valkey cache.Config
+
+	telemetry observability.Config
+	sampling  observability.SamplingConfig
+}
+
+// loadConfig reads the server configuration from command line flags. Every
+// flag defaults to the value of its environment variable when that is set.
+func loadConfig() (*config, error) {
+	cfg := &config{}
+
+	var err error
+	flag.StringVar(&cfg.storageBackend, "storage", envString("STORAGE_BACKEND", storagePostgres),
+		"history storage backend: postgres, sqlite or memory (STORAGE_BACKEND)")
+	flag.StringVar(&cfg.postgres.DSN, "postgres-dsn", envSecret("POSTGRES_DSN", "", &err),
+		"PostgreSQL connection string or URL, replacing the connection and TLS flags (POSTGRES_DSN or POSTGRES_DSN_FILE)")
+	flag.StringVar(&cfg.postgres.Host, "postgres-host", envString("POSTGRES_HOST", "postgres"),
+		"PostgreSQL primary host (POSTGRES_HOST)")
+	flag.IntVar(&cfg.postgres.Port, "postgres-port", envInt("POSTGRES_PORT", 5432, &err),
+		"PostgreSQL primary port (POSTGRES_PORT)")
+	flag.StringVar(&cfg.postgres.Username, "postgres-user", envString("POSTGRES_USER", "postgres"),
+		"PostgreSQL user (POSTGRES_USER)")
+	flag.StringVar(&cfg.postgres.Password, "postgres-password", envSecret("POSTGRES_PASSWORD", "password", &err),
+		"PostgreSQL password (POSTGRES_PASSWORD or POSTGRES_PASSWORD_FILE)")
+	flag.StringVar(&cfg.postgres.Database, "postgres-db", envString("POSTGRES_DB", "calculator"),
+		"PostgreSQL database (POSTGRES_DB)")
+	flag.StringVar(&cfg.postgres.TLS.Mode, "postgres-sslmode", envString("POSTGRES_SSLMODE", storage.SSLModeDisable),
+		"PostgreSQL TLS mode: disable, require, verify-ca or verify-full (POSTGRES_SSLMODE)")
+	flag.StringVar(&cfg.postgres.TLS.CAFile, "postgres-sslrootcert", envString("POSTGRES_SSLROOTCERT", ""),
+		"CA bundle used to verify PostgreSQL (POSTGRES_SSLROOTCERT)")
+	flag.StringVar(&cfg.postgres.TLS.CertFile, "postgres-sslcert", envString("POSTGRES_SSLCERT", ""),
+		"client certificate for PostgreSQL (POSTGRES_SSLCERT)")
+	flag.StringVar(&cfg.postgres.TLS.KeyFile, "postgres-sslkey", envString("POSTGRES_SSLKEY", ""),
+		"client certificate key for PostgreSQL (POSTGRES_SSLKEY)")
+	flag.IntVar(&cfg.postgres.Pool.MaxOpenConns, "postgres-max-open-conns", envInt("POSTGRES_MAX_OPEN_CONNS", 100, &err),
+		"maximum open connections per PostgreSQL node (POSTGRES_MAX_OPEN_CONNS)")
+	flag.IntVar(&cfg.postgres.Pool.MaxIdleConns, "postgres-max-idle-conns", envInt("POSTGRES_MAX_IDLE_CONNS", 10, &err),
+		"maximum idle connections per PostgreSQL node (POSTGRES_MAX_IDLE_CONNS)")
+	flag.DurationVar(&cfg.postgres.Pool.ConnMaxLifetime, "postgres-conn-max-lifetime", envDuration("POSTGRES_CONN_MAX_LIFETIME", 30*time.Minute, &err),
+		"maximum age of a PostgreSQL connection (POSTGRES_CONN_MAX_LIFETIME)")
+	flag.DurationVar(&cfg.postgres.Pool.ConnMaxIdleTime, "postgres-conn-max-idle-time", envDuration("POSTGRES_CONN_MAX_IDLE_TIME", 5*time.Minute, &err),
+		"maximum idle time of a PostgreSQL connection (POSTGRES_CONN_MAX_IDLE_TIME)")
+	flag.DurationVar(&cfg.postgres.ConnectTimeout, "postgres-connect-timeout", envDuration("POSTGRES_CONNECT_TIMEOUT", 30*time.Second, &err),
+		"how long startup retries reaching PostgreSQL, with exponential backoff (POSTGRES_CONNECT_TIMEOUT)")
+	var postgresReplicas string
+	flag.StringVar(&postgresReplicas, "postgres-replicas", envString("POSTGRES_REPLICAS", ""),
+		"comma separated host:port of PostgreSQL replicas serving history reads (POSTGRES_REPLICAS)")
+	flag.DurationVar(&cfg.postgres.MaxReplicaLag, "postgres-max-replica-lag", envDuration("POSTGRES_MAX_REPLICA_LAG", 5*time.Second, &err),
+		"replication lag above which reads fall back to the primary (POSTGRES_MAX_REPLICA_LAG)")
+	flag.DurationVar(&cfg.postgres.ReplicaCheckInterval, "postgres-replica-check-interval", envDuration("POSTGRES_REPLICA_CHECK_INTERVAL", 5*time.Second, &err),
+		"how often replica lag is measured (POSTGRES_REPLICA_CHECK_INTERVAL)")
+	flag.StringVar(&cfg.sqlitePath, "sqlite-path", envString("SQLITE_PATH", "calculator.db"),
+		"SQLite database file for the sqlite backend (SQLITE_PATH)")
+	flag.IntVar(&cfg.memoryCapacity, "memory-capacity", envInt("MEMORY_CAPACITY", 10_000, &err),
+		"records retained by the memory backend (MEMORY_CAPACITY)")
+	flag.BoolVar(&cfg.autoMigrate, "auto-migrate", envBool("AUTO_MIGRATE", true, &err),
+		"apply pending schema migrations on startup (AUTO_MIGRATE)")
+	flag.BoolVar(&cfg.historyAsync, "history-async", envBool("HISTORY_ASYNC", false, &err),
+		"queue history writes and flush them in batches; queued records are not returned by history reads until flushed (HISTORY_ASYNC)")
+	flag.IntVar(&cfg.historyQueueSize, "history-queue-size", envInt("HISTORY_QUEUE_SIZE", 10_000, &err),
+		"history records buffered before the overflow policy applies (HISTORY_QUEUE_SIZE)")
+	flag.IntVar(&cfg.historyBatchSize, "history-batch-size", envInt("HISTORY_BATCH_SIZE", 500, &err),
+		"history records flushed per batch (HISTORY_BATCH_SIZE)")
+	flag.DurationVar(&cfg.historyFlushInterval, "history-flush-interval", envDuration("HISTORY_FLUSH_INTERVAL", 200*time.Millisecond, &err),
+		"maximum time a history record waits before being flushed (HISTORY_FLUSH_INTERVAL)")
+	flag.StringVar(&cfg.historyOverflow, "history-overflow", envString("HISTORY_OVERFLOW", string(storage.OverflowBlock)),
+		"what to do when the history queue is full: block, drop or spill (HISTORY_OVERFLOW)")
+	flag.DurationVar(&cfg.historyDrainTimeout, "history-drain-timeout", envDuration("HISTORY_DRAIN_TIMEOUT", 10*time.Second, &err),
+		"time allowed to flush queued history on shutdown (HISTORY_DRAIN_TIMEOUT)")
+	flag.StringVar(&cfg.historyJournalPath, "history-journal-path", envString("HISTORY_JOURNAL_PATH", "history-journal.log"),
+		"local journal for history that could not be stored, empty to disable (HISTORY_JOURNAL_PATH)")
+	flag.DurationVar(&cfg.historyReplay, "history-replay-interval", envDuration("HISTORY_REPLAY_INTERVAL", 5*time.Second, &err),
+		"how often journaled history is replayed into storage (HISTORY_REPLAY_INTERVAL)")
+	flag.BoolVar(&cfg.partitionMaintenance, "partition-maintenance", envBool("PARTITION_MAINTENANCE", true, &err),
+		"create and expire PostgreSQL history partitions in the background (PARTITION_MAINTENANCE)")
+	flag.StringVar(&cfg.partitionInterval, "partition-interval", envString("PARTITION_INTERVAL", string(storage.PartitionMonthly)),
+		"period covered by one history partition: day or month (PARTITION_INTERVAL)")
+	flag.IntVar(&cfg.partitionPremake, "partition-premake", envInt("PARTITION_PREMAKE", 3, &err),
+		"history partitions created ahead of the current one (PARTITION_PREMAKE)")
+	flag.DurationVar(&cfg.partitionCheck, "partition-check-interval", envDuration("PARTITION_CHECK_INTERVAL", time.Hour, &err),
+		"how often history partitions are maintained (PARTITION_CHECK_INTERVAL)")
+	flag.DurationVar(&cfg.historyRetention, "history-retention", envDuration("HISTORY_RETENTION", 0, &err),
+		"drop PostgreSQL history older than this, 0 to keep it forever (HISTORY_RETENTION)")
+	flag.DurationVar(&cfg.cacheTTL, "cache-ttl", envDuration("CACHE_TTL", 10*time.Minute, &err),
+		"default expiry of cached results, 0 for none (CACHE_TTL)")
+	flag.Float64Var(&cfg.cacheJitter, "cache-ttl-jitter", envFloat("CACHE_TTL_JITTER", 0.1, &err),
+		"maximum random TTL extension as a fraction of the TTL (CACHE_TTL_JITTER)")
+	flag.DurationVar(&cfg.cacheMinComputeCost, "cache-min-compute", envDuration("CACHE_MIN_COMPUTE", 0, &err),
+		"results computed faster than this are not cached; 0 caches every result (CACHE_MIN_COMPUTE)")
+	flag.StringVar(&cfg.cacheRules, "cache-rules", envString("CACHE_RULES", ""),
+		`per-operation cache overrides, e.g. "divide:ttl=1h;add:disabled=true" (CACHE_RULES)`)
+	flag.StringVar(&cfg.adminAddr, "admin-addr", envString("ADMIN_ADDR", ":9464"),
+		"address of the admin server serving the admin endpoints, /metrics and the debug pages, empty to disable it (ADMIN_ADDR)")
+	var trustedProxies string
+	flag.StringVar(&trustedProxies, "trusted-proxies", envString("TRUSTED_PROXIES", ""),
+		"comma separated networks or addresses of the proxies whose X-Client-ID, X-Real-IP and X-Forwarded-For headers identify the client (TRUSTED_PROXIES)")
+	flag.IntVar(&cfg.cacheBreakerFailures, "cache-breaker-failures", envInt("CACHE_BREAKER_FAILURES", 5, &err),
+		"consecutive cache failures that open the circuit breaker (CACHE_BREAKER_FAILURES)")
+	flag.DurationVar(&cfg.cacheBreakerOpenTimeout, "cache-breaker-open-timeout", envDuration("CACHE_BREAKER_OPEN_TIMEOUT", 10*time.Second, &err),
+		"how long the cache circuit breaker stays open before probing (CACHE_BREAKER_OPEN_TIMEOUT)")
+	flag.IntVar(&cfg.cacheBreakerProbes, "cache-breaker-probes", envInt("CACHE_BREAKER_PROBES", 3, &err),
+		"half-open probe calls needed to close the cache circuit breaker (CACHE_BREAKER_PROBES)")
+	flag.DurationVar(&cfg.cacheCallTimeout, "cache-call-timeout", envDuration("CACHE_CALL_TIMEOUT", 100*time.Millisecond, &err),
+		"timeout of a single cache call, 0 for none (CACHE_CALL_TIMEOUT)")
+
+	var valkeyTopology, valkeyAddrs, valkeyReplicaAddrs string
+	flag.StringVar(&valkeyTopology, "valkey-topology", envString("VALKEY_TOPOLOGY", string(cache.TopologyStandalone)),
+		"Valkey deployment: standalone, cluster or sentinel (VALKEY_TOPOLOGY)")
+	flag.StringVar(&valkeyAddrs, "valkey-addrs", envString("VALKEY_ADDRS", "valkey:6379"),
+		"comma separated Valkey node addresses, or sentinel addresses (VALKEY_ADDRS)")
+	flag.StringVar(&valkeyReplicaAddrs, "valkey-replica-addrs", envString("VALKEY_REPLICA_ADDRS", ""),
+		"comma separated read replicas of a standalone primary (VALKEY_REPLICA_ADDRS)")
+	flag.StringVar(&cfg.valkey.MasterSet, "valkey-sentinel-master", envString("VALKEY_SENTINEL_MASTER", ""),
+		"master set name monitored by the sentinels (VALKEY_SENTINEL_MASTER)")
+	flag.StringVar(&cfg.valkey.Username, "valkey-username", envString("VALKEY_USERNAME", ""),
+		"Valkey ACL username (VALKEY_USERNAME)")
+	flag.StringVar(&cfg.valkey.Password, "valkey-password", envSecret("VALKEY_PASSWORD", "", &err),
+		"Valkey password (VALKEY_PASSWORD or VALKEY_PASSWORD_FILE)")
+	flag.StringVar(&cfg.valkey.SentinelUsername, "valkey-sentinel-username", envString("VALKEY_SENTINEL_USERNAME", ""),
+		"sentinel ACL username (VALKEY_SENTINEL_USERNAME)")
+	flag.StringVar(&cfg.valkey.SentinelPassword, "valkey-sentinel-password", envSecret("VALKEY_SENTINEL_PASSWORD", "", &err),
+		"sentinel password (VALKEY_SENTINEL_PASSWORD or VALKEY_SENTINEL_PASSWORD_FILE)")
+	flag.BoolVar(&cfg.valkey.ReplicaReads, "valkey-replica-reads", envBool("VALKEY_REPLICA_READS", false, &err),
+		"serve cache lookups from replicas (VALKEY_REPLICA_READS)")
+	flag.BoolVar(&cfg.valkey.TLS.Enabled, "valkey-tls", envBool("VALKEY_TLS", false, &err),
+		"connect to Valkey over TLS (VALKEY_TLS)")
+	flag.StringVar(&cfg.valkey.TLS.CAFile, "valkey-tls-ca", envString("VALKEY_TLS_CA", ""),
+		"CA bundle used to verify Valkey (VALKEY_TLS_CA)")
+	flag.StringVar(&cfg.valkey.TLS.CertFile, "valkey-tls-cert", envString("VALKEY_TLS_CERT", ""),
+		"client certificate for Valkey (VALKEY_TLS_CERT)")
+	flag.StringVar(&cfg.valkey.TLS.KeyFile, "valkey-tls-key", envString("VALKEY_TLS_KEY", ""),
+		"client certificate key for Valkey (VALKEY_TLS_KEY)")
+	flag.StringVar(&cfg.valkey.TLS.ServerName, "valkey-tls-server-name", envString("VALKEY_TLS_SERVER_NAME", ""),
+		"expected Valkey certificate name (VALKEY_TLS_SERVER_NAME)")
+	flag.BoolVar(&cfg.valkey.TLS.InsecureSkipVerify, "valkey-tls-insecure", envBool("VALKEY_TLS_INSECURE", false, &err),
+		"skip Valkey certificate verification (VALKEY_TLS_INSECURE)")
+	flag.StringVar(&cfg.telemetry.ServiceName, "service-name", envString("OTEL_SERVICE_NAME", appName),
+		"service.name reported with all telemetry (OTEL_SERVICE_NAME)")
+	flag.StringVar(&cfg.telemetry.ServiceVersion, "service-version", envString("SERVICE_VERSION", appVersion),
+		"service.version reported with all telemetry (SERVICE_VERSION)")
+	flag.StringVar(&cfg.telemetry.Environment, "environment", envString("DEPLOYMENT_ENVIRONMENT", appEnvironment),
+		"deployment.environment.name reported with all telemetry (DEPLOYMENT_ENVIRONMENT)")
+	flag.StringVar(&cfg.telemetry.Traces.Exporter, "otel-traces-exporter", envString("OTEL_TRACES_EXPORTER", observability.ExporterOTLP),
+		"trace exporter: otlp, console or none (OTEL_TRACES_EXPORTER)")
+	flag.StringVar(&cfg.telemetry.Metrics.Exporter, "otel-metrics-exporter", envString("OTEL_METRICS_EXPORTER", observability.ExporterOTLP),
+		"metric exporter: otlp, console, prometheus or none (OTEL_METRICS_EXPORTER)")
+	flag.StringVar(&cfg.telemetry.Logs.Exporter, "otel-logs-exporter", envString("OTEL_LOGS_EXPORTER", observability.ExporterOTLP),
+		"log exporter: otlp, console or none (OTEL_LOGS_EXPORTER)")
+	var otlpProtocol string
+	flag.StringVar(&otlpProtocol, "otel-protocol", envString("OTEL_EXPORTER_OTLP_PROTOCOL", observability.ProtocolGRPC),
+		"OTLP protocol: grpc or http/protobuf, overridden per signal by OTEL_EXPORTER_OTLP_{TRACES,METRICS,LOGS}_PROTOCOL (OTEL_EXPORTER_OTLP_PROTOCOL)")
+	var baggageKeys string
+	flag.StringVar(&baggageKeys, "baggage-keys", envString("BAGGAGE_KEYS", ""),
+		"comma separated baggage keys copied onto spans, logs and metrics, e.g. tenant,experiment (BAGGAGE_KEYS)")
+	var baggageMetricValues int
+	flag.IntVar(&baggageMetricValues, "baggage-metric-values", envInt("BAGGAGE_METRIC_VALUES", 0, &err),
+		`distinct values of each baggage key recorded on metrics, later ones are recorded as "other"; 0 keeps baggage off metrics (BAGGAGE_METRIC_VALUES)`)
+	var redactionRules, redactionHashKey string
+	flag.StringVar(&redactionRules, "redact", envString("REDACTION_POLICY", ""),
+		"comma separated redaction rules for span, log and metric attributes, e.g. calculator.input1=bucket,cache.key=hash; actions are keep, drop, hash and bucket (REDACTION_POLICY)")
+	flag.StringVar(&redactionHashKey, "redact-hash-key", envSecret("REDACTION_HASH_KEY", "", &err),
+		"key of the HMAC used by hash redaction rules (REDACTION_HASH_KEY or REDACTION_HASH_KEY_FILE)")
+	flag.IntVar(&cfg.telemetry.Limits.Count, "attribute-count-limit", envInt("OTEL_ATTRIBUTE_COUNT_LIMIT", 128, &err),
+		"maximum attributes per span and log record, -1 for no limit (OTEL_ATTRIBUTE_COUNT_LIMIT)")
+	flag.IntVar(&cfg.telemetry.Limits.ValueLength, "attribute-value-length-limit", envInt("OTEL_ATTRIBUTE_VALUE_LENGTH_LIMIT", -1, &err),
+		"maximum length of span and log attribute values, -1 for no limit (OTEL_ATTRIBUTE_VALUE_LENGTH_LIMIT)")
+	var samplingRoutes string
+	flag.Float64Var(&cfg.sampling.Ratio, "trace-sample-ratio", envSampleRatio(&err),
+		"fraction of new traces sampled; spans continuing a trace follow their parent (OTEL_TRACES_SAMPLER and OTEL_TRACES_SAMPLER_ARG)")
+	flag.StringVar(&samplingRoutes, "trace-sample-routes", envString("TRACE_SAMPLE_ROUTES", "/ping=0,/history=1"),
+		"comma separated per-route sampling ratios, e.g. /ping=0,/history=1 (TRACE_SAMPLE_ROUTES)")
+	flag.Float64Var(&cfg.sampling.RateLimit, "trace-rate-limit", envFloat("TRACE_RATE_LIMIT", 0, &err),
+		"maximum traces sampled per second by this replica, 0 for no limit (TRACE_RATE_LIMIT)")
+	flag.BoolVar(&cfg.sampling.KeepErrors, "trace-keep-errors", envBool("TRACE_KEEP_ERRORS", true, &err),
+		"export spans that end with an error even when their trace is not sampled (TRACE_KEEP_ERRORS)")
+	flag.StringVar(&cfg.telemetry.Fallback.Mode, "telemetry-fallback", envString("TELEMETRY_FALLBACK", observability.FallbackNone),
+		"where traces, metrics and logs go while the OpenTelemetry collector is unreachable: none or stdout (TELEMETRY_FALLBACK)")
+	flag.DurationVar(&cfg.telemetry.Fallback.ProbeInterval, "telemetry-probe-interval", envDuration("TELEMETRY_PROBE_INTERVAL", 5*time.Second, &err),
+		"how often an unreachable OpenTelemetry collector is probed (TELEMETRY_PROBE_INTERVAL)")
+	flag.BoolVar(&cfg.telemetry.Debug.Enabled, "debug-pages", envBool("DEBUG_PAGES", false, &err),
+		"serve /debug/tracez and /debug/rpcz on the admin server (DEBUG_PAGES)")
+	flag.StringVar(&cfg.telemetry.Debug.JaegerURL, "jaeger-url", envString("JAEGER_UI_URL", "http://localhost:16686"),
+		"base URL of the Jaeger UI linked from the debug pages (JAEGER_UI_URL)")
+	flag.BoolVar(&cfg.telemetry.Prometheus, "prometheus-metrics", envBool("PROMETHEUS_METRICS", false, &err),
+		"serve metrics for Prometheus to scrape on the admin server, alongside the metric exporter (PROMETHEUS_METRICS)")
+	if err != nil {
+		return nil, err
+	}
+
+	flag.Parse()
+
+	cfg.postgres.Replicas = splitList(postgresReplicas)
+	cfg.valkey.Topology = cache.Topology(valkeyTopology)
+	cfg.valkey.Addresses = splitList(valkeyAddrs)
+	cfg.valkey.ReplicaAddresses = splitList(valkeyReplicaAddrs)
+	cfg.telemetry.Baggage = observability.NewBaggageAllowlist(splitList(baggageKeys), baggageMetricValues)
+	if cfg.telemetry.Redaction, err = observability.ParseRedactionPolicy(redactionRules, redactionHashKey); err != nil {
+		return nil, err
+	}
+	if cfg.sampling.Routes, err = observability.ParseSamplingRoutes(samplingRoutes); err != nil {
+		return nil, err
+	}
+	if cfg.trustedProxies, err = app.ParseTrustedProxies(splitList(trustedProxies)); err != nil {
+		return nil, err
+	}
+	cfg.telemetry.Traces.Protocol = envString("OTEL_EXPORTER_OTLP_TRACES_PROTOCOL", otlpProtocol)
+	cfg.telemetry.Metrics.Protocol = envString("OTEL_EXPORTER_OTLP_METRICS_PROTOCOL", otlpProtocol)
+	cfg.telemetry.Logs.Protocol = envString("OTEL_EXPORTER_OTLP_LOGS_PROTOCOL", otlpProtocol)
+
+	return cfg, nil
+}
+
+func envString(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok {
+		return value
+	}
+
+	return fallback
+}
+
+// envSecret is envString for values that may instead be read from the file
+// named by the key with a _FILE suffix, such as a mounted secret. Every
+// password and key is read with it.
+func envSecret(key, fallback string, errp *error) string {
+	path, ok := os.LookupEnv(key + "_FILE")
+	if !ok {
+		return envString(key, fallback)
+	}
+
+	value, err := os.ReadFile(path)
+	if err != nil {
+		*errp = errors.Join(*errp, fmt.Errorf("invalid %s_FILE: %w", key, err))
+		return fallback
+	}
+
+	return strings.TrimRight(string(value), "\r\n")
+}
+
+func envDuration(key string, fallback time.Duration, errp *error) time.Duration {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		*errp = errors.Join(*errp, fmt.Errorf("invalid %s: %w", key, err))
+		return fallback
+	}
+
+	return d
+}
+
+func envBool(key string, fallback bool, errp *error) bool {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		*errp = errors.Join(*errp, fmt.Errorf("invalid %s: %w", key, err))
+		return fallback
+	}
+
+	return b
+}
+
+func envInt(key string, fallback int, errp *error) int {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+
+	i, err := strconv.Atoi(value)
+	if err != nil {
+		*errp = errors.Join(*errp, fmt.Errorf("invalid %s: %w", key, err))
+		return fallback
+	}
+
+	return i
+}
+
+func envFloat(key string, fallback float64, errp *error) float64 {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return fallback
+	}
+
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		*errp = errors.Join(*errp, fmt.Errorf("invalid %s: %w", key, err))
+		return fallback
+	}
+
+	return f
+}
+
+// envSampleRatio returns the ratio of new traces sampled according to the
+// standard OTEL_TRACES_SAMPLER and OTEL_TRACES_SAMPLER_ARG variables. The
+// server's sampler always follows the parent of a span, so the samplers that
+// are not parent based select the same ratio as those that are.
+func envSampleRatio(errp *error) float64 {
+	switch sampler := envString("OTEL_TRACES_SAMPLER", "parentbased_always_on"); sampler {
+	case "always_on", "parentbased_always_on":
+		return 1
+	case "always_off", "parentbased_always_off":
+		return 0
+	case "traceidratio", "parentbased_traceidratio":
+		return envFloat("OTEL_TRACES_SAMPLER_ARG", 1, errp)
+	default:
+		*errp = errors.Join(*errp, fmt.Errorf("unsupported OTEL_TRACES_SAMPLER %q", sampler))
+		return 1
+	}
+}
+
+// splitList splits a comma separated list, dropping empty entries.
+func splitList(value string) []string {
+	var items []string
+	for item := range strings.SplitSeq(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
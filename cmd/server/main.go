@@ -2,13 +2,15 @@ package main
 
 import (
 	"context"
+	"flag"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"syscall"
 	"time"
 
-	"github.com/valkey-io/valkey-go"
 	"github.com/valkey-io/valkey-go/valkeyotel"
 	"go.opentelemetry.io/contrib/bridges/otelslog"
 	"go.opentelemetry.io/otel"
@@ -16,11 +18,16 @@ import (
 
 	"calculator-otel/internal/app"
 	"calculator-otel/internal/cache"
+	"calculator-otel/internal/logger"
+	"calculator-otel/internal/metrics"
 	"calculator-otel/internal/observability"
 	"calculator-otel/internal/service"
 	"calculator-otel/internal/storage"
 )
 
+// appName names the tracer and meters of the server. Together with appVersion
+// and appEnvironment it is also the default service identity reported with
+// telemetry.
 const (
 	appName        = "calculator-otel"
 	appVersion     = "1.0.0"
@@ -29,65 +36,218 @@ const (
 
 func main() {
 	ctx := context.Background()
-	signCtx, cancel := signal.NotifyContext(ctx, os.Interrupt)
+
+	cfg, err := loadConfig()
+	if err != nil {
+		slog.ErrorContext(ctx, "failed to load configuration", "error", err)
+		os.Exit(2)
+	}
+
+	if args := flag.Args(); len(args) > 0 {
+		if args[0] != "migrate" {
+			fmt.Fprintf(os.Stderr, "unknown command %q\n", args[0])
+			os.Exit(2)
+		}
+		os.Exit(runMigrate(ctx, cfg, args[1:]))
+	}
+
+	sampler, err := observability.NewSampler(cfg.sampling)
+	if err != nil {
+		slog.ErrorContext(ctx, "invalid trace sampling configuration", "error", err)
+		os.Exit(2)
+	}
+	cfg.telemetry.Sampler = sampler
+
+	adminMux := http.NewServeMux()
+	if cfg.adminAddr != "" {
+		cfg.telemetry.AdminMux = adminMux
+	}
+
+	// Startup failures are logged and return from main so that everything
+	// started so far is shut down; the exit status is set last.
+	exitCode := 0
+	defer func() {
+		if exitCode != 0 {
+			os.Exit(exitCode)
+		}
+	}()
+
+	signCtx, cancel := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
-	otelShutdown, err := observability.InitOpenTelemetry(
-		ctx,
-		appName,
-		appVersion,
-		appEnvironment,
-	)
+	otelShutdown, err := observability.InitOpenTelemetry(ctx, cfg.telemetry)
 	if err != nil {
-		slog.ErrorContext(ctx, "failed to initialize OpenTelemetry", "error", err)
+		slog.ErrorContext(ctx, "failed to initialize OpenTelemetry, telemetry will not be exported", "error", err)
+		otelShutdown = func(context.Context) error { return nil }
 	}
 
 	defer otelShutdown(ctx)
 
-	otelSlogHandler := otelslog.NewHandler(appName, otelslog.WithLoggerProvider(global.GetLoggerProvider()))
-	logger := slog.New(otelSlogHandler)
+	// Logs always go to stderr as well, so they survive a missing collector.
+	// Each handler passes records on to the one it wraps, so the baggage
+	// handler, added last, copies baggage onto a record before the redacting
+	// handler sees it, and baggage members are redacted too.
+	logHandler := logger.NewTeeHandler(
+		otelslog.NewHandler(appName, otelslog.WithLoggerProvider(global.GetLoggerProvider())),
+		slog.NewJSONHandler(os.Stderr, nil),
+	)
+	logHandler = logger.NewRedactingHandler(logHandler, cfg.telemetry.Redaction)
+	logHandler = logger.NewBaggageHandler(logHandler, cfg.telemetry.Baggage)
+	logger := slog.New(logHandler)
+	slog.SetDefault(logger)
 
 	logger.InfoContext(ctx, "starting calculator server")
 	defer logger.InfoContext(ctx, "shutting down calculator server")
 
-	db, closeFn, err := storage.NewPostgresDb(&storage.Config{
-		Username: "postgres",
-		Password: "password",
-		Host:     "postgres",
-		Port:     5432,
-		Database: "calculator",
-	})
+	db, closeFn, err := openStorage(ctx, logger, cfg)
 	if err != nil {
-		logger.ErrorContext(ctx, "failed to connect to PostgreSQL database", "error", err)
+		logger.ErrorContext(ctx, "failed to open history storage", "error", err, "backend", cfg.storageBackend)
+		exitCode = 1
 		return
 	}
 	defer func() {
 		if err := closeFn(); err != nil {
-			logger.ErrorContext(ctx, "failed to close PostgreSQL database connection", "error", err)
+			logger.ErrorContext(ctx, "failed to close history storage", "error", err)
 		}
 	}()
 
-	valkyClient, err := valkeyotel.NewClient(valkey.ClientOption{InitAddress: []string{"valkey:6379"}})
+	if cfg.storageBackend == storagePostgres && cfg.partitionMaintenance {
+		maintenanceCtx, stopMaintenance := context.WithCancel(ctx)
+		maintenanceDone := make(chan struct{})
+		go func() {
+			defer close(maintenanceDone)
+			runPartitionMaintenance(maintenanceCtx, logger, cfg)
+		}()
+		defer func() {
+			stopMaintenance()
+			<-maintenanceDone
+		}()
+	}
+
+	var history storage.Storage = db
+	var journal *storage.Journal
+	if cfg.historyJournalPath != "" {
+		journal, err = storage.OpenJournal(cfg.historyJournalPath)
+		if err != nil {
+			logger.ErrorContext(ctx, "failed to open history journal", "error", err)
+			exitCode = 1
+			return
+		}
+		journaled, err := storage.NewJournaled(db, journal, storage.JournaledConfig{
+			ReplayInterval: cfg.historyReplay,
+			BatchSize:      cfg.historyBatchSize,
+		}, logger, otel.Meter(appName))
+		if err != nil {
+			logger.ErrorContext(ctx, "failed to start history journal replay", "error", err)
+			exitCode = 1
+			return
+		}
+		defer journaled.Close()
+		history = journaled
+	}
+
+	if cfg.historyAsync {
+		writeBehind, err := storage.NewWriteBehind(history, storage.WriteBehindConfig{
+			QueueSize:     cfg.historyQueueSize,
+			BatchSize:     cfg.historyBatchSize,
+			FlushInterval: cfg.historyFlushInterval,
+			Overflow:      storage.OverflowPolicy(cfg.historyOverflow),
+			Journal:       journal,
+		}, logger, otel.Meter(appName))
+		if err != nil {
+			logger.ErrorContext(ctx, "failed to start history write-behind queue", "error", err)
+			exitCode = 1
+			return
+		}
+		defer func() {
+			drainCtx, cancelDrain := context.WithTimeout(context.Background(), cfg.historyDrainTimeout)
+			defer cancelDrain()
+			if err := writeBehind.Close(drainCtx); err != nil {
+				logger.ErrorContext(ctx, "failed to drain history queue", "error", err)
+			}
+		}()
+		history = writeBehind
+	}
+
+	valkeyOption, err := cfg.valkey.ClientOption()
+	if err != nil {
+		logger.ErrorContext(ctx, "invalid Valkey configuration", "error", err)
+		exitCode = 1
+		return
+	}
+
+	valkyClient, err := valkeyotel.NewClient(valkeyOption)
 	if err != nil {
 		logger.ErrorContext(ctx, "failed to create Valkey client", "error", err)
+		exitCode = 1
+		return
+	}
+	defer valkyClient.Close()
+
+	if err := cache.RegisterStatsGauges(valkyClient, otel.Meter(appName)); err != nil {
+		logger.ErrorContext(ctx, "failed to register Valkey stats gauges", "error", err)
+	}
+
+	cachePolicy := cache.NewPolicy(cache.Rule{
+		TTL:            cfg.cacheTTL,
+		Jitter:         cfg.cacheJitter,
+		MinComputeCost: cfg.cacheMinComputeCost,
+	})
+	if err := cachePolicy.ParseRules(cfg.cacheRules); err != nil {
+		logger.ErrorContext(ctx, "invalid cache rules", "error", err)
+		exitCode = 1
 		return
 	}
 
-	cache := cache.New[int](valkyClient)
+	cache, err := cache.NewBreaker(cache.New[int](valkyClient), cache.BreakerConfig{
+		FailureThreshold: cfg.cacheBreakerFailures,
+		OpenTimeout:      cfg.cacheBreakerOpenTimeout,
+		HalfOpenProbes:   cfg.cacheBreakerProbes,
+		CallTimeout:      cfg.cacheCallTimeout,
+	}, logger, otel.Meter(appName))
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to create cache circuit breaker", "error", err)
+		exitCode = 1
+		return
+	}
 
-	service := service.New(logger, cache, db)
+	appMetrics, err := metrics.New(otel.Meter(appName), cfg.telemetry.Baggage)
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to create application metrics", "error", err)
+		exitCode = 1
+		return
+	}
 
-	tracer := otel.Tracer(appName)
+	service := service.New(logger, cache, cachePolicy, history, observability.InstanceID(), appMetrics, otel.Tracer(appName))
 
-	app := app.New(logger, service, tracer)
+	app := app.New(logger, service, appMetrics, sampler, cfg.telemetry.Baggage, cfg.trustedProxies)
 	mux := app.InitializeRoutes()
+	app.InitializeAdminRoutes(adminMux)
 
 	server := &http.Server{
 		Addr:    ":8080",
 		Handler: mux,
 	}
 
+	// The admin server is kept off the public port so that it can be
+	// firewalled separately.
+	var adminServer *http.Server
+	if cfg.adminAddr != "" {
+		adminServer = &http.Server{
+			Addr:    cfg.adminAddr,
+			Handler: adminMux,
+		}
+		go func() {
+			logger.InfoContext(ctx, "admin server listening", "address", cfg.adminAddr)
+			if err := adminServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logger.ErrorContext(ctx, "failed to start admin server", "error", err)
+			}
+		}()
+	}
+
+	shutdownDone := make(chan struct{})
 	go func() {
+		defer close(shutdownDone)
 		<-signCtx.Done()
 		logger.InfoContext(ctx, "received shutdown signal, shutting down server")
 		shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), 5*time.Second)
@@ -95,13 +255,22 @@ func main() {
 		if err := server.Shutdown(shutdownCtx); err != nil {
 			logger.ErrorContext(ctx, "failed to shutdown server gracefully", "error", err)
 		}
+		if adminServer != nil {
+			if err := adminServer.Shutdown(shutdownCtx); err != nil {
+				logger.ErrorContext(ctx, "failed to shutdown admin server gracefully", "error", err)
+			}
+		}
 	}()
 
 	logger.InfoContext(ctx, "listening on :8080")
 	if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 		logger.ErrorContext(ctx, "failed to start server", "error", err)
+		exitCode = 1
 		return
 	}
 
+	// Wait for in-flight requests so their history is queued before draining.
+	<-shutdownDone
+
 	logger.InfoContext(ctx, "server shutdown complete")
 }
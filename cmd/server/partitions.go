@@ -0,0 +1,71 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"calculator-otel/internal/logger"
+	"calculator-otel/internal/storage"
+)
+
+// partitionLockKey identifies the advisory lock electing the replica that
+// maintains the history partitions.
+const partitionLockKey int64 = 0x63616c635f707274 // "calc_prt"
+
+// runPartitionMaintenance keeps the PostgreSQL history partitions ready and
+// within retention until ctx is done. Every replica runs it, but only the
+// elected leader touches the schema.
+func runPartitionMaintenance(ctx context.Context, logger logger.Logger, cfg *config) {
+	db, err := storage.OpenPostgres(&cfg.postgres, "partitions")
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to connect for partition maintenance", "error", err)
+		return
+	}
+	defer db.Close()
+
+	partitioner, err := storage.NewPartitioner(db, storage.PartitionConfig{
+		Interval:  storage.PartitionInterval(cfg.partitionInterval),
+		Premake:   cfg.partitionPremake,
+		Retention: cfg.historyRetention,
+	})
+	if err != nil {
+		logger.ErrorContext(ctx, "invalid partition configuration", "error", err)
+		return
+	}
+
+	leader := storage.NewLeader(db, partitionLockKey)
+	defer leader.Release(context.WithoutCancel(ctx))
+
+	ticker := time.NewTicker(cfg.partitionCheck)
+	defer ticker.Stop()
+
+	for {
+		isLeader, err := leader.Acquire(ctx)
+		switch {
+		case err != nil:
+			logger.ErrorContext(ctx, "failed to elect partition maintenance leader", "error", err)
+		case isLeader:
+			maintainPartitions(ctx, logger, partitioner)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func maintainPartitions(ctx context.Context, logger logger.Logger, partitioner *storage.Partitioner) {
+	report, err := partitioner.Maintain(ctx, time.Now())
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to maintain history partitions", "error", err)
+	}
+	if report == nil {
+		return
+	}
+	if len(report.Created) > 0 || len(report.Dropped) > 0 || report.Purged > 0 {
+		logger.InfoContext(ctx, "maintained history partitions",
+			"created", report.Created, "dropped", report.Dropped, "purged", report.Purged)
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"calculator-otel/internal/logger"
+	"calculator-otel/internal/storage"
+	"calculator-otel/internal/storage/migrations"
+)
+
+const (
+	storagePostgres = "postgres"
+	storageSQLite   = "sqlite"
+	storageMemory   = "memory"
+)
+
+// openStorage opens the configured history backend.
+func openStorage(ctx context.Context, logger logger.Logger, cfg *config) (storage.Storage, storage.CloseFn, error) {
+	switch cfg.storageBackend {
+	case storagePostgres:
+		if cfg.autoMigrate {
+			if err := migrateUp(ctx, logger, cfg); err != nil {
+				return nil, nil, fmt.Errorf("failed to migrate database schema: %w", err)
+			}
+		}
+		return storage.NewPostgresDb(&cfg.postgres)
+	case storageSQLite:
+		return storage.NewSQLiteDb(ctx, cfg.sqlitePath)
+	case storageMemory:
+		logger.WarnContext(ctx, "history is kept in memory and lost on restart", "capacity", cfg.memoryCapacity)
+		return storage.NewMemoryDb(cfg.memoryCapacity), func() error { return nil }, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown storage backend %q", cfg.storageBackend)
+	}
+}
+
+// openMigrator connects to the configured database for running migrations.
+func openMigrator(cfg *config) (*migrations.Migrator, *sql.DB, error) {
+	var db *sql.DB
+	var dialect migrations.Dialect
+	var err error
+	switch cfg.storageBackend {
+	case storagePostgres:
+		db, err = storage.OpenPostgres(&cfg.postgres, "migrate")
+		dialect = migrations.Postgres
+	case storageSQLite:
+		db, err = storage.OpenSQLite(cfg.sqlitePath)
+		dialect = migrations.SQLite
+	default:
+		return nil, nil, fmt.Errorf("storage backend %q has no schema to migrate", cfg.storageBackend)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	migrator, err := migrations.New(db, dialect)
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+
+	return migrator, db, nil
+}
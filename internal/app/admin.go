@@ -0,0 +1,178 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"calculator-otel/internal/cache"
+	"calculator-otel/internal/observability"
+)
+
+const defaultWarmCount = 1000
+
+func (a *app) CacheInspectHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	key := r.PathValue("key")
+
+	entry, err := a.service.InspectCache(ctx, key)
+	if errors.Is(err, cache.ErrKeyNotFound) {
+		http.Error(w, "Key not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, cache.ErrInvalidValue) {
+		http.Error(w, "Key does not hold a calculation result", http.StatusUnprocessableEntity)
+		return
+	}
+	if err != nil {
+		a.logger.ErrorContext(ctx, "failed to inspect cache entry", "error", err, "key", key)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	response := CacheEntryResponse{
+		Key:        entry.Key,
+		Value:      entry.Value,
+		TTLSeconds: entry.TTL.Seconds(),
+	}
+	if entry.TTL == cache.NoExpiry {
+		response.TTLSeconds = -1
+	}
+
+	a.writeJSON(w, r, response)
+}
+
+func (a *app) CacheDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	key := r.PathValue("key")
+
+	existed, err := a.service.DeleteCacheKey(ctx, key)
+	if err != nil {
+		a.logger.ErrorContext(ctx, "failed to delete cache entry", "error", err, "key", key)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	if !existed {
+		http.Error(w, "Key not found", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (a *app) CacheInvalidateHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	pattern := r.URL.Query().Get("pattern")
+	if pattern == "" {
+		http.Error(w, "Missing pattern", http.StatusBadRequest)
+		return
+	}
+
+	deleted, err := a.service.InvalidateCache(ctx, pattern)
+	if err != nil {
+		a.logger.ErrorContext(ctx, "failed to invalidate cache", "error", err, "pattern", pattern)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	a.writeJSON(w, r, CacheInvalidateResponse{Pattern: pattern, Deleted: deleted})
+}
+
+func (a *app) CacheWarmHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	count, err := queryInt(r, "count", defaultWarmCount)
+	if err != nil || count <= 0 {
+		http.Error(w, "Invalid count", http.StatusBadRequest)
+		return
+	}
+
+	warmed, err := a.service.WarmCache(ctx, count)
+	if err != nil {
+		a.logger.ErrorContext(ctx, "failed to warm cache", "error", err, "count", count)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	a.writeJSON(w, r, CacheWarmResponse{Requested: count, Warmed: warmed})
+}
+
+func (a *app) SamplingHandler(w http.ResponseWriter, r *http.Request) {
+	a.writeJSON(w, r, samplingResponse(a.sampler.Config()))
+}
+
+func (a *app) SamplingUpdateHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	var req SamplingUpdateRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	// Config returns a copy, so the update is prepared without touching the
+	// configuration in effect.
+	config := a.sampler.Config()
+	if req.Ratio != nil {
+		config.Ratio = *req.Ratio
+	}
+	for route, ratio := range req.Routes {
+		if ratio == nil {
+			delete(config.Routes, route)
+		} else {
+			config.Routes[route] = *ratio
+		}
+	}
+	if req.RateLimit != nil {
+		config.RateLimit = *req.RateLimit
+	}
+	if req.KeepErrors != nil {
+		config.KeepErrors = *req.KeepErrors
+	}
+
+	if err := a.sampler.Update(config); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	a.logger.InfoContext(ctx, "updated trace sampling", "ratio", config.Ratio, "routes", config.Routes,
+		"rate_limit", config.RateLimit, "keep_errors", config.KeepErrors)
+
+	a.writeJSON(w, r, samplingResponse(config))
+}
+
+func samplingResponse(config observability.SamplingConfig) SamplingConfig {
+	return SamplingConfig{
+		Ratio:      config.Ratio,
+		Routes:     config.Routes,
+		RateLimit:  config.RateLimit,
+		KeepErrors: config.KeepErrors,
+	}
+}
+
+func (a *app) writeJSON(w http.ResponseWriter, r *http.Request, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		a.logger.ErrorContext(r.Context(), "failed to encode response", "error", err)
+	}
+}
+
+// queryInt parses the named query parameter, returning fallback when it is
+// absent.
+func queryInt(r *http.Request, name string, fallback int) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return fallback, nil
+	}
+
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s: %w", name, err)
+	}
+
+	return n, nil
+}
@@ -2,48 +2,90 @@ package app
 
 import (
 	"encoding/json"
+	"fmt"
+	"net"
 	"net/http"
+	"net/netip"
+	"strings"
+	"time"
 
 	"calculator-otel/internal/logger"
+	"calculator-otel/internal/metrics"
+	"calculator-otel/internal/observability"
 	"calculator-otel/internal/service"
+	"calculator-otel/internal/storage"
 
 	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/trace"
 )
 
 type app struct {
 	logger  logger.Logger
 	service *service.Service
-	tracer  trace.Tracer
+	metrics *metrics.Metrics
+	sampler *observability.Sampler
+	baggage *observability.BaggageAllowlist
+	proxies TrustedProxies
 }
 
-func New(logger logger.Logger, service *service.Service, tracer trace.Tracer) *app {
+func New(logger logger.Logger, service *service.Service, metrics *metrics.Metrics, sampler *observability.Sampler, baggage *observability.BaggageAllowlist, proxies TrustedProxies) *app {
 	return &app{
 		logger:  logger,
 		service: service,
-		tracer:  tracer,
+		metrics: metrics,
+		sampler: sampler,
+		baggage: baggage,
+		proxies: proxies,
 	}
 }
 
 func (a *app) InitializeRoutes() *http.ServeMux {
 	mux := http.NewServeMux()
 
-	mux.Handle("GET /ping", otelhttp.NewHandler(http.HandlerFunc(a.pingHandler), "PingHandler"))
-	mux.Handle("POST /ping", otelhttp.NewHandler(http.HandlerFunc(a.pingHandler), "PingHandler"))
+	mux.Handle("GET /ping", a.instrument(a.pingHandler, "PingHandler"))
+	mux.Handle("POST /ping", a.instrument(a.pingHandler, "PingHandler"))
 
-	mux.Handle("POST /calculate", otelhttp.NewHandler(http.HandlerFunc(a.CalculateHandler), "CalculateHandler"))
-	mux.Handle("GET /history", otelhttp.NewHandler(http.HandlerFunc(a.HistoryHandler), "HistoryHandler"))
+	mux.Handle("POST /calculate", a.instrument(a.CalculateHandler, "CalculateHandler"))
+	mux.Handle("GET /history", a.instrument(a.HistoryHandler, "HistoryHandler"))
 
 	return mux
 }
 
+// InitializeAdminRoutes registers the administration endpoints on mux, which
+// is served on the admin port rather than the public one.
+func (a *app) InitializeAdminRoutes(mux *http.ServeMux) {
+	mux.Handle("GET /admin/cache/{key}", a.instrument(a.CacheInspectHandler, "CacheInspectHandler"))
+	mux.Handle("DELETE /admin/cache/{key}", a.instrument(a.CacheDeleteHandler, "CacheDeleteHandler"))
+	mux.Handle("POST /admin/cache/invalidate", a.instrument(a.CacheInvalidateHandler, "CacheInvalidateHandler"))
+	mux.Handle("POST /admin/cache/warm", a.instrument(a.CacheWarmHandler, "CacheWarmHandler"))
+
+	mux.Handle("GET /admin/sampling", a.instrument(a.SamplingHandler, "SamplingHandler"))
+	mux.Handle("PUT /admin/sampling", a.instrument(a.SamplingUpdateHandler, "SamplingUpdateHandler"))
+}
+
+// instrument traces handler and records its HTTP server metrics, with the
+// allowed baggage members of the request as metric attributes, capped as set
+// by the allowlist.
+func (a *app) instrument(handler http.HandlerFunc, operation string) http.Handler {
+	return otelhttp.NewHandler(handler, operation, otelhttp.WithMetricAttributesFn(func(r *http.Request) []attribute.KeyValue {
+		return a.baggage.MetricAttributes(r.Context())
+	}))
+}
+
 func (a *app) pingHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write([]byte("pong"))
 }
 
 func (a *app) CalculateHandler(w http.ResponseWriter, r *http.Request) {
-	ctx := r.Context()
+	ctx := service.WithClientID(r.Context(), a.clientIdentity(r))
+
+	start := time.Now()
+	operation, outcome := metrics.UnknownOperation, metrics.OutcomeInvalid
+	defer func() {
+		a.metrics.RecordRequest(ctx, operation, outcome, time.Since(start))
+	}()
 
 	req := &Request{}
 	if err := json.NewDecoder(r.Body).Decode(req); err != nil {
@@ -51,19 +93,21 @@ func (a *app) CalculateHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	operation = req.Operation
+
 	var result int
 	switch req.Operation {
 	case service.OperandAdd:
-		a.logger.InfoContext(ctx, "performing addition", "input1", req.Input1, "input2", req.Input2)
+		a.logger.InfoContext(ctx, "performing addition", "calculator.input1", req.Input1, "calculator.input2", req.Input2)
 		result = a.service.Add(ctx, req.Input1, req.Input2)
 	case service.OperandSubtract:
-		a.logger.InfoContext(ctx, "performing subtraction", "input1", req.Input1, "input2", req.Input2)
+		a.logger.InfoContext(ctx, "performing subtraction", "calculator.input1", req.Input1, "calculator.input2", req.Input2)
 		result = a.service.Subtract(ctx, req.Input1, req.Input2)
 	case service.OperandMultiply:
-		a.logger.InfoContext(ctx, "performing multiplication", "input1", req.Input1, "input2", req.Input2)
+		a.logger.InfoContext(ctx, "performing multiplication", "calculator.input1", req.Input1, "calculator.input2", req.Input2)
 		result = a.service.Multiply(ctx, req.Input1, req.Input2)
 	case service.OperandDivide:
-		a.logger.InfoContext(ctx, "performing division", "input1", req.Input1, "input2", req.Input2)
+		a.logger.InfoContext(ctx, "performing division", "calculator.input1", req.Input1, "calculator.input2", req.Input2)
 		var err error
 		result, err = a.service.Divide(ctx, req.Input1, req.Input2)
 		if err != nil {
@@ -71,7 +115,8 @@ func (a *app) CalculateHandler(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 	default:
-		a.logger.ErrorContext(ctx, "invalid operation", "operation", req.Operation)
+		a.logger.ErrorContext(ctx, "invalid operation", "calculator.operation", req.Operation)
+		operation = metrics.UnknownOperation
 		http.Error(w, "Invalid operation", http.StatusBadRequest)
 		return
 	}
@@ -82,18 +127,35 @@ func (a *app) CalculateHandler(w http.ResponseWriter, r *http.Request) {
 	if err := json.NewEncoder(w).Encode(response); err != nil {
 		a.logger.ErrorContext(ctx, "failed to encode response", "error", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		outcome = metrics.OutcomeError
 		return
 	}
 
 	w.WriteHeader(http.StatusOK)
+	outcome = metrics.OutcomeSuccess
 
-	a.logger.InfoContext(ctx, "calculation successful", "operation", req.Operation, "result", result)
+	a.logger.InfoContext(ctx, "calculation successful", "calculator.operation", req.Operation, "calculator.result", result)
 }
 
 func (a *app) HistoryHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 
-	history, err := a.service.GetHistory(ctx)
+	limit, err := queryInt(r, "limit", 0)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	var history []*storage.HistoryRecord
+	if traceID := r.URL.Query().Get("trace_id"); traceID != "" {
+		if _, err := trace.TraceIDFromHex(traceID); err != nil {
+			http.Error(w, "Invalid trace_id", http.StatusBadRequest)
+			return
+		}
+		history, err = a.service.GetHistoryByTraceID(ctx, traceID)
+	} else {
+		history, err = a.service.GetHistory(ctx, limit)
+	}
 	if err != nil {
 		a.logger.ErrorContext(ctx, "failed to get history", "error", err)
 		http.Error(w, "Internal server error", http.StatusInternalServerError)
@@ -113,3 +175,75 @@ func (a *app) HistoryHandler(w http.ResponseWriter, r *http.Request) {
 
 	w.WriteHeader(http.StatusOK)
 }
+
+// TrustedProxies are the networks of the load balancers and proxies whose
+// client headers are believed.
+type TrustedProxies []netip.Prefix
+
+// ParseTrustedProxies parses networks in CIDR notation or single addresses.
+func ParseTrustedProxies(networks []string) (TrustedProxies, error) {
+	var proxies TrustedProxies
+	for _, network := range networks {
+		if addr, err := netip.ParseAddr(network); err == nil {
+			proxies = append(proxies, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(network)
+		if err != nil {
+			return nil, fmt.Errorf("invalid trusted proxy %q: %w", network, err)
+		}
+		proxies = append(proxies, prefix.Masked())
+	}
+
+	return proxies, nil
+}
+
+// trusts reports whether addr belongs to a trusted proxy.
+func (p TrustedProxies) trusts(addr string) bool {
+	ip, err := netip.ParseAddr(addr)
+	if err != nil {
+		return false
+	}
+	ip = ip.Unmap()
+	for _, prefix := range p {
+		if prefix.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// clientIdentity identifies the caller of r by the address seen on the
+// connection. Requests relayed by a trusted proxy are identified by the
+// X-Client-ID header when the client sends one, otherwise by the client
+// address the proxy reports. Headers from anyone else are ignored, as they
+// are set by the caller.
+func (a *app) clientIdentity(r *http.Request) string {
+	peer := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		peer = host
+	}
+	if !a.proxies.trusts(peer) {
+		return peer
+	}
+
+	if clientID := r.Header.Get("X-Client-ID"); clientID != "" {
+		return clientID
+	}
+	if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
+		return realIP
+	}
+	// Each proxy appends the address it received the request from, so the
+	// last entry not added by a trusted proxy is the client.
+	if forwarded := r.Header.Values("X-Forwarded-For"); len(forwarded) > 0 {
+		hops := strings.Split(strings.Join(forwarded, ","), ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			if hop := strings.TrimSpace(hops[i]); hop != "" && !a.proxies.trusts(hop) {
+				return hop
+			}
+		}
+	}
+
+	return peer
+}
@@ -10,3 +10,38 @@ type Response struct {
 	Result int    `json:"result"`
 	Error  string `json:"error,omitempty"`
 }
+
+type CacheEntryResponse struct {
+	Key   string `json:"key"`
+	Value int    `json:"value"`
+	// TTLSeconds is -1 when the entry never expires.
+	TTLSeconds float64 `json:"ttl_seconds"`
+}
+
+type CacheInvalidateResponse struct {
+	Pattern string `json:"pattern"`
+	Deleted int64  `json:"deleted"`
+}
+
+type CacheWarmResponse struct {
+	Requested int `json:"requested"`
+	Warmed    int `json:"warmed"`
+}
+
+// SamplingConfig is the trace sampling configuration.
+type SamplingConfig struct {
+	Ratio      float64            `json:"ratio"`
+	Routes     map[string]float64 `json:"routes"`
+	RateLimit  float64            `json:"rate_limit"`
+	KeepErrors bool               `json:"keep_errors"`
+}
+
+// SamplingUpdateRequest changes the trace sampling configuration. Fields that
+// are left out keep their current value. Routes are merged into the current
+// ones, and a route set to null loses its override.
+type SamplingUpdateRequest struct {
+	Ratio      *float64            `json:"ratio"`
+	Routes     map[string]*float64 `json:"routes"`
+	RateLimit  *float64            `json:"rate_limit"`
+	KeepErrors *bool               `json:"keep_errors"`
+}
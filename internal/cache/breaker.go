@@ -0,0 +1,284 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"calculator-otel/internal/logger"
+
+	"go.opentelemetry.io/otel/metric"
+)
+
+// ErrCircuitOpen is returned without contacting the cache while the breaker is
+// open.
+var ErrCircuitOpen = errors.New("cache circuit breaker is open")
+
+type BreakerState int
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerHalfOpen
+	BreakerOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerHalfOpen:
+		return "half-open"
+	case BreakerOpen:
+		return "open"
+	default:
+		return fmt.Sprintf("BreakerState(%d)", int(s))
+	}
+}
+
+type BreakerConfig struct {
+	// FailureThreshold is the number of consecutive failures that opens the
+	// breaker.
+	FailureThreshold int
+	// OpenTimeout is how long the breaker stays open before letting probes
+	// through.
+	OpenTimeout time.Duration
+	// HalfOpenProbes is the number of concurrent probe calls allowed while
+	// half-open, and the number of successes needed to close again.
+	HalfOpenProbes int
+	// CallTimeout bounds every key-level call. Zero leaves calls bounded only
+	// by the caller's context.
+	CallTimeout time.Duration
+}
+
+type breaker[T any] struct {
+	next   Cache[T]
+	config BreakerConfig
+	logger logger.Logger
+
+	mu    sync.Mutex
+	state BreakerState
+	// generation counts state transitions. A call records the generation it
+	// was admitted in, and its outcome is ignored once the breaker has moved
+	// on, so that a slow call started while closed cannot reopen a breaker
+	// that has since recovered, or use up the probes of a later half-open
+	// period.
+	generation  uint64
+	failures    int
+	openedAt    time.Time
+	probes      int
+	probePasses int
+}
+
+// NewBreaker wraps next with a circuit breaker so that a slow or unavailable
+// cache fails fast instead of holding up every request. The breaker state is
+// reported through the cache.breaker.state gauge.
+func NewBreaker[T any](next Cache[T], config BreakerConfig, logger logger.Logger, meter metric.Meter) (Cache[T], error) {
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = 1
+	}
+	if config.HalfOpenProbes <= 0 {
+		config.HalfOpenProbes = 1
+	}
+
+	b := &breaker[T]{
+		next:   next,
+		config: config,
+		logger: logger,
+	}
+
+	_, err := meter.Int64ObservableGauge(
+		"cache.breaker.state",
+		metric.WithDescription("Cache circuit breaker state: 0 closed, 1 half-open, 2 open"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			b.mu.Lock()
+			defer b.mu.Unlock()
+			o.Observe(int64(b.currentState(time.Now())))
+			return nil
+		}),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create breaker state gauge: %w", err)
+	}
+
+	return b, nil
+}
+
+func (b *breaker[T]) Set(ctx context.Context, key string, value T) error {
+	return b.call(ctx, true, func(ctx context.Context) error {
+		return b.next.Set(ctx, key, value)
+	})
+}
+
+func (b *breaker[T]) SetWithTTL(ctx context.Context, key string, value T, ttl time.Duration) error {
+	return b.call(ctx, true, func(ctx context.Context) error {
+		return b.next.SetWithTTL(ctx, key, value, ttl)
+	})
+}
+
+func (b *breaker[T]) Get(ctx context.Context, key string) (T, error) {
+	var value T
+	err := b.call(ctx, true, func(ctx context.Context) error {
+		var err error
+		value, err = b.next.Get(ctx, key)
+		return err
+	})
+
+	return value, err
+}
+
+func (b *breaker[T]) Delete(ctx context.Context, keys ...string) (int64, error) {
+	var deleted int64
+	err := b.call(ctx, true, func(ctx context.Context) error {
+		var err error
+		deleted, err = b.next.Delete(ctx, keys...)
+		return err
+	})
+
+	return deleted, err
+}
+
+func (b *breaker[T]) TTL(ctx context.Context, key string) (time.Duration, error) {
+	var ttl time.Duration
+	err := b.call(ctx, true, func(ctx context.Context) error {
+		var err error
+		ttl, err = b.next.TTL(ctx, key)
+		return err
+	})
+
+	return ttl, err
+}
+
+// Scan walks the whole keyspace, so it is not bound by the per-call timeout.
+func (b *breaker[T]) Scan(ctx context.Context, pattern string) ([]string, error) {
+	var keys []string
+	err := b.call(ctx, false, func(ctx context.Context) error {
+		var err error
+		keys, err = b.next.Scan(ctx, pattern)
+		return err
+	})
+
+	return keys, err
+}
+
+func (b *breaker[T]) call(ctx context.Context, bounded bool, fn func(context.Context) error) error {
+	generation, ok := b.allow(ctx)
+	if !ok {
+		return ErrCircuitOpen
+	}
+
+	callCtx := ctx
+	if bounded && b.config.CallTimeout > 0 {
+		var cancel context.CancelFunc
+		callCtx, cancel = context.WithTimeout(ctx, b.config.CallTimeout)
+		defer cancel()
+	}
+
+	err := fn(callCtx)
+	if err != nil && ctx.Err() != nil {
+		// The caller gave up, which says nothing about the cache's health.
+		b.release(generation)
+		return err
+	}
+	// Missing keys and values of the wrong type are answers from a healthy
+	// cache.
+	b.record(ctx, generation, err == nil || errors.Is(err, ErrKeyNotFound) || errors.Is(err, ErrInvalidValue))
+
+	return err
+}
+
+// currentState returns the state, treating an open breaker whose timeout has
+// elapsed as half-open. b.mu must be held.
+func (b *breaker[T]) currentState(now time.Time) BreakerState {
+	if b.state == BreakerOpen && now.Sub(b.openedAt) >= b.config.OpenTimeout {
+		return BreakerHalfOpen
+	}
+
+	return b.state
+}
+
+// allow reports whether a call may go through, and the generation it is
+// admitted in.
+func (b *breaker[T]) allow(ctx context.Context) (uint64, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.currentState(time.Now()) {
+	case BreakerClosed:
+		return b.generation, true
+	case BreakerHalfOpen:
+		if b.state == BreakerOpen {
+			b.transition(ctx, BreakerHalfOpen)
+		}
+		if b.probes >= b.config.HalfOpenProbes {
+			return 0, false
+		}
+		b.probes++
+		return b.generation, true
+	default:
+		return 0, false
+	}
+}
+
+// record counts the outcome of a call admitted in generation, unless the
+// breaker has changed state since.
+func (b *breaker[T]) record(ctx context.Context, generation uint64, success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation != b.generation {
+		return
+	}
+
+	switch b.state {
+	case BreakerClosed:
+		if success {
+			b.failures = 0
+			return
+		}
+		b.failures++
+		if b.failures >= b.config.FailureThreshold {
+			b.transition(ctx, BreakerOpen)
+		}
+	case BreakerHalfOpen:
+		if !success {
+			b.transition(ctx, BreakerOpen)
+			return
+		}
+		b.probePasses++
+		if b.probePasses >= b.config.HalfOpenProbes {
+			b.transition(ctx, BreakerClosed)
+		}
+	}
+}
+
+// release returns a half-open probe slot without recording an outcome.
+func (b *breaker[T]) release(generation uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation == b.generation && b.state == BreakerHalfOpen && b.probes > 0 {
+		b.probes--
+	}
+}
+
+// transition moves the breaker to state and resets its counters. b.mu must be
+// held.
+func (b *breaker[T]) transition(ctx context.Context, state BreakerState) {
+	from := b.state
+	b.state = state
+	b.generation++
+	b.failures = 0
+	b.probes = 0
+	b.probePasses = 0
+	if state == BreakerOpen {
+		b.openedAt = time.Now()
+	}
+
+	if state == BreakerClosed {
+		b.logger.InfoContext(ctx, "cache circuit breaker state changed", "from", from.String(), "to", state.String())
+		return
+	}
+	b.logger.WarnContext(ctx, "cache circuit breaker state changed", "from", from.String(), "to", state.String())
+}
@@ -0,0 +1,318 @@
+package cache_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"calculator-otel/internal/cache"
+
+	"go.opentelemetry.io/otel/metric/noop"
+)
+
+var errUnavailable = errors.New("cache unavailable")
+
+// fakeCache answers Get with whatever get returns and counts the calls that
+// reach it.
+type fakeCache struct {
+	cache.Cache[int]
+	get   func(ctx context.Context) error
+	calls atomic.Int32
+}
+
+func (f *fakeCache) Get(ctx context.Context, key string) (int, error) {
+	f.calls.Add(1)
+	return 0, f.get(ctx)
+}
+
+func newBreaker(t *testing.T, next cache.Cache[int], config cache.BreakerConfig) cache.Cache[int] {
+	t.Helper()
+
+	b, err := cache.NewBreaker(next, config, slog.New(slog.NewTextHandler(io.Discard, nil)), noop.NewMeterProvider().Meter("test"))
+	if err != nil {
+		t.Fatalf("NewBreaker: %v", err)
+	}
+
+	return b
+}
+
+func TestBreakerTransitions(t *testing.T) {
+	const openTimeout = 20 * time.Millisecond
+
+	type step struct {
+		// wait is slept before the call.
+		wait time.Duration
+		// result is what the cache answers if the call reaches it.
+		result error
+		// want is what the breaker returns. ErrCircuitOpen also means that
+		// the call must not reach the cache.
+		want error
+	}
+
+	tests := []struct {
+		name   string
+		config cache.BreakerConfig
+		steps  []step
+	}{
+		{
+			name:   "closed stays closed below the failure threshold",
+			config: cache.BreakerConfig{FailureThreshold: 3, OpenTimeout: openTimeout},
+			steps: []step{
+				{result: errUnavailable, want: errUnavailable},
+				{result: errUnavailable, want: errUnavailable},
+				{want: nil},
+				{result: errUnavailable, want: errUnavailable},
+				{result: errUnavailable, want: errUnavailable},
+				{want: nil},
+			},
+		},
+		{
+			name:   "closed opens after consecutive failures",
+			config: cache.BreakerConfig{FailureThreshold: 2, OpenTimeout: openTimeout},
+			steps: []step{
+				{result: errUnavailable, want: errUnavailable},
+				{result: errUnavailable, want: errUnavailable},
+				{want: cache.ErrCircuitOpen},
+				{want: cache.ErrCircuitOpen},
+			},
+		},
+		{
+			name:   "missing and invalid values do not count as failures",
+			config: cache.BreakerConfig{FailureThreshold: 1, OpenTimeout: openTimeout},
+			steps: []step{
+				{result: cache.ErrKeyNotFound, want: cache.ErrKeyNotFound},
+				{result: cache.ErrInvalidValue, want: cache.ErrInvalidValue},
+				{want: nil},
+			},
+		},
+		{
+			name:   "open turns half-open after the open timeout and closes on probe success",
+			config: cache.BreakerConfig{FailureThreshold: 1, OpenTimeout: openTimeout, HalfOpenProbes: 2},
+			steps: []step{
+				{result: errUnavailable, want: errUnavailable},
+				{want: cache.ErrCircuitOpen},
+				{wait: openTimeout, want: nil},
+				{want: nil},
+				{result: errUnavailable, want: errUnavailable},
+				{want: cache.ErrCircuitOpen},
+			},
+		},
+		{
+			name:   "half-open reopens on probe failure",
+			config: cache.BreakerConfig{FailureThreshold: 1, OpenTimeout: openTimeout, HalfOpenProbes: 2},
+			steps: []step{
+				{result: errUnavailable, want: errUnavailable},
+				{wait: openTimeout, want: nil},
+				{result: errUnavailable, want: errUnavailable},
+				{want: cache.ErrCircuitOpen},
+				{wait: openTimeout, want: nil},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var result error
+			fake := &fakeCache{get: func(context.Context) error { return result }}
+			b := newBreaker(t, fake, tt.config)
+
+			for i, step := range tt.steps {
+				time.Sleep(step.wait)
+				result = step.result
+				calls := fake.calls.Load()
+
+				_, err := b.Get(context.Background(), "key")
+				if !errors.Is(err, step.want) || (step.want == nil && err != nil) {
+					t.Fatalf("step %d: got error %v, want %v", i, err, step.want)
+				}
+				reached := fake.calls.Load() > calls
+				if reached == errors.Is(step.want, cache.ErrCircuitOpen) {
+					t.Fatalf("step %d: call reached cache = %v with error %v", i, reached, err)
+				}
+			}
+		})
+	}
+}
+
+func TestBreakerProbeLimit(t *testing.T) {
+	tests := []struct {
+		name   string
+		probes int
+	}{
+		{name: "one probe", probes: 1},
+		{name: "three probes", probes: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			const openTimeout = 20 * time.Millisecond
+
+			var failing atomic.Bool
+			failing.Store(true)
+			started := make(chan struct{})
+			unblock := make(chan struct{})
+			fake := &fakeCache{get: func(context.Context) error {
+				if failing.Load() {
+					return errUnavailable
+				}
+				started <- struct{}{}
+				<-unblock
+				return nil
+			}}
+			b := newBreaker(t, fake, cache.BreakerConfig{FailureThreshold: 1, OpenTimeout: openTimeout, HalfOpenProbes: tt.probes})
+
+			if _, err := b.Get(context.Background(), "key"); !errors.Is(err, errUnavailable) {
+				t.Fatalf("got error %v, want %v", err, errUnavailable)
+			}
+			failing.Store(false)
+			time.Sleep(openTimeout)
+
+			var wg sync.WaitGroup
+			for range tt.probes {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					if _, err := b.Get(context.Background(), "key"); err != nil {
+						t.Errorf("probe: %v", err)
+					}
+				}()
+				<-started
+			}
+
+			if _, err := b.Get(context.Background(), "key"); !errors.Is(err, cache.ErrCircuitOpen) {
+				t.Fatalf("call beyond the probe limit: got error %v, want %v", err, cache.ErrCircuitOpen)
+			}
+
+			close(unblock)
+			wg.Wait()
+
+			// Every probe succeeded, so the breaker is closed again.
+			go func() { <-started }()
+			if _, err := b.Get(context.Background(), "key"); err != nil {
+				t.Fatalf("after probes: %v", err)
+			}
+		})
+	}
+}
+
+func TestBreakerCallTimeout(t *testing.T) {
+	tests := []struct {
+		name string
+		// callerTimeout bounds the caller's context, zero leaves it unbounded.
+		callerTimeout time.Duration
+		wantOpen      bool
+	}{
+		{name: "per-call timeout counts as a failure", wantOpen: true},
+		{name: "caller giving up does not count", callerTimeout: 5 * time.Millisecond, wantOpen: false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeCache{get: func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			}}
+			callTimeout := 10 * time.Millisecond
+			if tt.callerTimeout > 0 {
+				callTimeout = 200 * time.Millisecond
+			}
+			b := newBreaker(t, fake, cache.BreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute, CallTimeout: callTimeout})
+
+			ctx := context.Background()
+			if tt.callerTimeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tt.callerTimeout)
+				defer cancel()
+			}
+
+			start := time.Now()
+			if _, err := b.Get(ctx, "key"); !errors.Is(err, context.DeadlineExceeded) {
+				t.Fatalf("got error %v, want %v", err, context.DeadlineExceeded)
+			}
+			if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+				t.Fatalf("call took %v, want it bounded by the timeout", elapsed)
+			}
+
+			_, err := b.Get(context.Background(), "key")
+			if open := errors.Is(err, cache.ErrCircuitOpen); open != tt.wantOpen {
+				t.Fatalf("breaker open = %v, want %v", open, tt.wantOpen)
+			}
+		})
+	}
+}
+
+func TestBreakerIgnoresStaleGeneration(t *testing.T) {
+	const openTimeout = 20 * time.Millisecond
+
+	tests := []struct {
+		name string
+		// staleResult is the outcome of the slow call admitted while the
+		// breaker was still closed.
+		staleResult error
+	}{
+		{name: "late failure does not reopen a recovered breaker", staleResult: errUnavailable},
+		{name: "late success does not count as a probe", staleResult: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			started := make(chan struct{})
+			unblock := make(chan struct{})
+			var mode atomic.Int32 // 0 slow, 1 failing, 2 healthy
+			fake := &fakeCache{get: func(context.Context) error {
+				switch mode.Load() {
+				case 0:
+					close(started)
+					<-unblock
+					return tt.staleResult
+				case 1:
+					return errUnavailable
+				default:
+					return nil
+				}
+			}}
+			b := newBreaker(t, fake, cache.BreakerConfig{FailureThreshold: 2, OpenTimeout: openTimeout, HalfOpenProbes: 2})
+
+			slowDone := make(chan struct{})
+			go func() {
+				defer close(slowDone)
+				b.Get(context.Background(), "slow")
+			}()
+			<-started
+
+			// Open the breaker and let it turn half-open.
+			mode.Store(1)
+			for range 2 {
+				if _, err := b.Get(context.Background(), "key"); !errors.Is(err, errUnavailable) {
+					t.Fatalf("got error %v, want %v", err, errUnavailable)
+				}
+			}
+			time.Sleep(openTimeout)
+			mode.Store(2)
+			if _, err := b.Get(context.Background(), "key"); err != nil {
+				t.Fatalf("first probe: %v", err)
+			}
+
+			// The slow call from the closed period finishes now.
+			close(unblock)
+			<-slowDone
+
+			// The breaker is still half-open with one probe to go. Had the
+			// late failure counted, the probe would be refused; had the late
+			// success counted, the breaker would be closed and need two
+			// failures to open.
+			mode.Store(1)
+			if _, err := b.Get(context.Background(), "key"); !errors.Is(err, errUnavailable) {
+				t.Fatalf("second probe: got error %v, want %v", err, errUnavailable)
+			}
+			if _, err := b.Get(context.Background(), "key"); !errors.Is(err, cache.ErrCircuitOpen) {
+				t.Fatalf("got error %v, want %v after a failed probe", err, cache.ErrCircuitOpen)
+			}
+		})
+	}
+}
@@ -2,13 +2,24 @@ package cache
 
 import (
 	"context"
+	"errors"
 	"time"
 )
 
-var ErrKeyNotFound = "key not found"
+var ErrKeyNotFound = errors.New("key not found")
+
+// ErrInvalidValue is returned when a stored value cannot be read as the
+// cache's value type, such as a key written by something else.
+var ErrInvalidValue = errors.New("invalid cached value")
+
+// NoExpiry is returned by TTL for keys that never expire.
+const NoExpiry time.Duration = -1
 
 type Cache[T any] interface {
 	Set(ctx context.Context, key string, value T) error
 	SetWithTTL(ctx context.Context, key string, value T, ttl time.Duration) error
 	Get(ctx context.Context, key string) (T, error)
+	Delete(ctx context.Context, keys ...string) (int64, error)
+	TTL(ctx context.Context, key string) (time.Duration, error)
+	Scan(ctx context.Context, pattern string) ([]string, error)
 }
@@ -0,0 +1,144 @@
+package cache
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+
+	"github.com/valkey-io/valkey-go"
+)
+
+// Topology is the Valkey deployment the client connects to.
+type Topology string
+
+const (
+	TopologyStandalone Topology = "standalone"
+	TopologyCluster    Topology = "cluster"
+	TopologySentinel   Topology = "sentinel"
+)
+
+type Config struct {
+	Topology Topology
+	// Addresses are the nodes of a standalone server or cluster, or the
+	// sentinels when Topology is TopologySentinel.
+	Addresses []string
+	// ReplicaAddresses are read-only replicas of a standalone primary.
+	ReplicaAddresses []string
+	// MasterSet is the master name monitored by the sentinels.
+	MasterSet string
+
+	Username string
+	Password string
+	// SentinelUsername and SentinelPassword authenticate against the
+	// sentinels themselves, which may differ from the data nodes.
+	SentinelUsername string
+	SentinelPassword string
+
+	TLS TLSConfig
+
+	// ReplicaReads sends GET to replicas when the topology has any.
+	ReplicaReads bool
+}
+
+type TLSConfig struct {
+	Enabled            bool
+	CAFile             string
+	CertFile           string
+	KeyFile            string
+	ServerName         string
+	InsecureSkipVerify bool
+}
+
+// ClientOption converts the configuration into valkey client options.
+func (c *Config) ClientOption() (valkey.ClientOption, error) {
+	if len(c.Addresses) == 0 {
+		return valkey.ClientOption{}, fmt.Errorf("no Valkey addresses configured")
+	}
+
+	tlsConfig, err := c.TLS.build()
+	if err != nil {
+		return valkey.ClientOption{}, err
+	}
+
+	option := valkey.ClientOption{
+		InitAddress: c.Addresses,
+		Username:    c.Username,
+		Password:    c.Password,
+		TLSConfig:   tlsConfig,
+	}
+
+	if c.ReplicaReads {
+		option.SendToReplicas = isReplicaRead
+	}
+
+	switch c.Topology {
+	case TopologyStandalone, "":
+		if len(c.ReplicaAddresses) > 0 {
+			option.Standalone.ReplicaAddress = c.ReplicaAddresses
+			if option.SendToReplicas == nil {
+				return valkey.ClientOption{}, fmt.Errorf("replica addresses require replica reads to be enabled")
+			}
+		} else {
+			option.ForceSingleClient = true
+			option.SendToReplicas = nil
+		}
+	case TopologyCluster:
+		option.ShuffleInit = true
+	case TopologySentinel:
+		if c.MasterSet == "" {
+			return valkey.ClientOption{}, fmt.Errorf("sentinel topology requires a master set name")
+		}
+		option.Sentinel = valkey.SentinelOption{
+			MasterSet: c.MasterSet,
+			Username:  c.SentinelUsername,
+			Password:  c.SentinelPassword,
+			TLSConfig: tlsConfig,
+		}
+	default:
+		return valkey.ClientOption{}, fmt.Errorf("unknown Valkey topology %q", c.Topology)
+	}
+
+	return option, nil
+}
+
+// isReplicaRead selects the commands that may be served by a replica. Only
+// result lookups qualify; admin reads such as TTL and SCAN stay on the primary
+// so they reflect the latest writes.
+func isReplicaRead(cmd valkey.Completed) bool {
+	commands := cmd.Commands()
+	return len(commands) > 0 && commands[0] == "GET"
+}
+
+func (c *TLSConfig) build() (*tls.Config, error) {
+	if !c.Enabled {
+		return nil, nil
+	}
+
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		ServerName:         c.ServerName,
+		InsecureSkipVerify: c.InsecureSkipVerify,
+	}
+
+	if c.CAFile != "" {
+		ca, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read Valkey CA file: %w", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in Valkey CA file %s", c.CAFile)
+		}
+	}
+
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load Valkey client certificate: %w", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+
+	return config, nil
+}
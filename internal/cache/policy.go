@@ -0,0 +1,118 @@
+package cache
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Rule controls how results of a single operation are cached.
+type Rule struct {
+	// TTL is the base expiry of a cached result. Zero stores without expiry.
+	TTL time.Duration
+	// Jitter is the maximum random extension added to TTL, as a fraction of
+	// it, so that entries written together do not all expire together.
+	Jitter float64
+	// MinComputeCost is the compute time below which a result is not cached,
+	// because fetching it back would cost more than recomputing it. Zero
+	// caches every result; the rule is opt-in, since the built-in operations
+	// compute faster than any cache round trip and a non-zero default would
+	// leave nothing cached.
+	MinComputeCost time.Duration
+	// Disabled bypasses the cache for the operation entirely.
+	Disabled bool
+}
+
+// Policy holds the caching rules for every operation.
+type Policy struct {
+	Default    Rule
+	Operations map[string]Rule
+}
+
+func NewPolicy(defaultRule Rule) *Policy {
+	return &Policy{
+		Default:    defaultRule,
+		Operations: make(map[string]Rule),
+	}
+}
+
+// Rule returns the rule configured for operation, or the default rule.
+func (p *Policy) Rule(operation string) Rule {
+	if rule, ok := p.Operations[operation]; ok {
+		return rule
+	}
+
+	return p.Default
+}
+
+// Enabled reports whether results of operation are read from and written to
+// the cache at all.
+func (p *Policy) Enabled(operation string) bool {
+	return !p.Rule(operation).Disabled
+}
+
+// ShouldStore reports whether a result that took computeCost to produce is
+// worth caching.
+func (p *Policy) ShouldStore(operation string, computeCost time.Duration) bool {
+	rule := p.Rule(operation)
+	return !rule.Disabled && computeCost >= rule.MinComputeCost
+}
+
+// TTL returns the expiry for a new entry of operation with jitter applied.
+func (p *Policy) TTL(operation string) time.Duration {
+	rule := p.Rule(operation)
+	if rule.TTL <= 0 || rule.Jitter <= 0 {
+		return rule.TTL
+	}
+
+	return rule.TTL + time.Duration(rand.Float64()*rule.Jitter*float64(rule.TTL))
+}
+
+// ParseRules applies per-operation overrides to the policy. The spec is a
+// semicolon separated list of "operation:key=value,..." entries, for example
+// "divide:ttl=1h,jitter=0.2;add:disabled=true". Fields that are not set
+// inherit from the default rule.
+func (p *Policy) ParseRules(spec string) error {
+	for entry := range strings.SplitSeq(spec, ";") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		operation, fields, ok := strings.Cut(entry, ":")
+		if !ok || operation == "" {
+			return fmt.Errorf("invalid cache rule %q: expected operation:key=value", entry)
+		}
+
+		rule := p.Default
+		for field := range strings.SplitSeq(fields, ",") {
+			key, value, ok := strings.Cut(strings.TrimSpace(field), "=")
+			if !ok {
+				return fmt.Errorf("invalid cache rule field %q for %s", field, operation)
+			}
+
+			var err error
+			switch key {
+			case "ttl":
+				rule.TTL, err = time.ParseDuration(value)
+			case "jitter":
+				rule.Jitter, err = strconv.ParseFloat(value, 64)
+			case "min_compute":
+				rule.MinComputeCost, err = time.ParseDuration(value)
+			case "disabled":
+				rule.Disabled, err = strconv.ParseBool(value)
+			default:
+				err = fmt.Errorf("unknown field %q", key)
+			}
+			if err != nil {
+				return fmt.Errorf("invalid cache rule for %s: %w", operation, err)
+			}
+		}
+
+		p.Operations[operation] = rule
+	}
+
+	return nil
+}
@@ -0,0 +1,91 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/valkey-io/valkey-go"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// statsGauges maps INFO fields to the gauges they are reported as.
+var statsGauges = []struct {
+	field       string
+	name        string
+	unit        string
+	description string
+}{
+	{"used_memory", "valkey.memory.used", "By", "Memory allocated by Valkey"},
+	{"maxmemory", "valkey.memory.limit", "By", "Configured Valkey memory limit, zero when unlimited"},
+	{"evicted_keys", "valkey.keys.evicted", "{key}", "Keys evicted because of the memory limit"},
+	{"expired_keys", "valkey.keys.expired", "{key}", "Keys removed after their TTL elapsed"},
+	{"keyspace_hits", "valkey.keyspace.hits", "{lookup}", "Successful key lookups"},
+	{"keyspace_misses", "valkey.keyspace.misses", "{lookup}", "Failed key lookups"},
+}
+
+// RegisterStatsGauges exposes Valkey memory and eviction statistics as
+// observable gauges, read from INFO on every collection. Each node of a
+// cluster is reported separately under the valkey.node attribute.
+func RegisterStatsGauges(client valkey.Client, meter metric.Meter) error {
+	gauges := make(map[string]metric.Int64ObservableGauge, len(statsGauges))
+	instruments := make([]metric.Observable, 0, len(statsGauges))
+	for _, g := range statsGauges {
+		gauge, err := meter.Int64ObservableGauge(g.name, metric.WithUnit(g.unit), metric.WithDescription(g.description))
+		if err != nil {
+			return fmt.Errorf("failed to create %s gauge: %w", g.name, err)
+		}
+		gauges[g.field] = gauge
+		instruments = append(instruments, gauge)
+	}
+
+	_, err := meter.RegisterCallback(func(ctx context.Context, o metric.Observer) error {
+		var errs []error
+		for addr, node := range client.Nodes() {
+			info, err := node.Do(ctx, node.B().Info().Section("memory", "stats").Build()).ToString()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("failed to read Valkey info from %s: %w", addr, err))
+				continue
+			}
+
+			nodeAttr := metric.WithAttributes(attribute.String("valkey.node", addr))
+			for field, value := range parseInfo(info) {
+				gauge, ok := gauges[field]
+				if !ok {
+					continue
+				}
+				n, err := strconv.ParseInt(value, 10, 64)
+				if err != nil {
+					continue
+				}
+				o.ObserveInt64(gauge, n, nodeAttr)
+			}
+		}
+
+		return errors.Join(errs...)
+	}, instruments...)
+	if err != nil {
+		return fmt.Errorf("failed to register Valkey stats callback: %w", err)
+	}
+
+	return nil
+}
+
+// parseInfo parses the "field:value" lines of an INFO reply.
+func parseInfo(info string) map[string]string {
+	fields := make(map[string]string)
+	for line := range strings.Lines(info) {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if field, value, ok := strings.Cut(line, ":"); ok {
+			fields[field] = value
+		}
+	}
+
+	return fields
+}
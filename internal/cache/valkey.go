@@ -9,6 +9,8 @@ import (
 	"github.com/valkey-io/valkey-go"
 )
 
+const scanCount = 500
+
 type valkeyCache[T any] struct {
 	client valkey.Client
 }
@@ -27,7 +29,14 @@ func (c *valkeyCache[T]) Set(ctx context.Context, key string, value T) error {
 }
 
 func (c *valkeyCache[T]) SetWithTTL(ctx context.Context, key string, value T, ttl time.Duration) error {
-	err := c.client.Do(ctx, c.client.B().Set().Key(key).Value(valueToString(value)).Ex(ttl).Build()).Error()
+	if ttl <= 0 {
+		return c.Set(ctx, key, value)
+	}
+
+	// PX keeps sub-second TTLs, which EX would truncate to seconds or reject
+	// as zero. Anything under a millisecond is rounded up to one.
+	ttl = max(ttl, time.Millisecond)
+	err := c.client.Do(ctx, c.client.B().Set().Key(key).Value(valueToString(value)).Px(ttl).Build()).Error()
 	if err != nil {
 		return fmt.Errorf("failed to set value with TTL: %w", err)
 	}
@@ -38,14 +47,13 @@ func (c *valkeyCache[T]) SetWithTTL(ctx context.Context, key string, value T, tt
 func (c *valkeyCache[T]) Get(ctx context.Context, key string) (T, error) {
 	var value T
 	result, err := c.client.Do(ctx, c.client.B().Get().Key(key).Build()).AsBytes()
+	if valkey.IsValkeyNil(err) || (err == nil && result == nil) {
+		return value, fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+	}
 	if err != nil {
 		return value, fmt.Errorf("failed to get value: %w", err)
 	}
 
-	if result == nil {
-		return value, fmt.Errorf("key not found: %s", key)
-	}
-
 	value, err = stringToValue[T](string(result))
 	if err != nil {
 		return value, fmt.Errorf("failed to convert value: %w", err)
@@ -54,6 +62,78 @@ func (c *valkeyCache[T]) Get(ctx context.Context, key string) (T, error) {
 	return value, nil
 }
 
+// Delete removes keys with one DEL per key, pipelined, so that keys in
+// different cluster slots can be deleted together.
+func (c *valkeyCache[T]) Delete(ctx context.Context, keys ...string) (int64, error) {
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	commands := make(valkey.Commands, 0, len(keys))
+	for _, key := range keys {
+		commands = append(commands, c.client.B().Del().Key(key).Build())
+	}
+
+	var deleted int64
+	for _, result := range c.client.DoMulti(ctx, commands...) {
+		n, err := result.AsInt64()
+		if err != nil {
+			return deleted, fmt.Errorf("failed to delete keys: %w", err)
+		}
+		deleted += n
+	}
+
+	return deleted, nil
+}
+
+func (c *valkeyCache[T]) TTL(ctx context.Context, key string) (time.Duration, error) {
+	ms, err := c.client.Do(ctx, c.client.B().Pttl().Key(key).Build()).AsInt64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to get TTL: %w", err)
+	}
+
+	switch ms {
+	case -2:
+		return 0, fmt.Errorf("%w: %s", ErrKeyNotFound, key)
+	case -1:
+		return NoExpiry, nil
+	}
+
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// Scan returns the keys matching pattern. It walks the keyspace of every node
+// with SCAN in batches of scanCount so that large caches do not block the
+// server the way KEYS would. Keys seen on more than one node, as happens with
+// replicas, are returned once.
+func (c *valkeyCache[T]) Scan(ctx context.Context, pattern string) ([]string, error) {
+	seen := make(map[string]struct{})
+	var keys []string
+	for addr, node := range c.client.Nodes() {
+		var cursor uint64
+		for {
+			entry, err := node.Do(ctx, node.B().Scan().Cursor(cursor).Match(pattern).Count(scanCount).Build()).AsScanEntry()
+			if err != nil {
+				return nil, fmt.Errorf("failed to scan keys on %s: %w", addr, err)
+			}
+
+			for _, key := range entry.Elements {
+				if _, ok := seen[key]; !ok {
+					seen[key] = struct{}{}
+					keys = append(keys, key)
+				}
+			}
+
+			cursor = entry.Cursor
+			if cursor == 0 {
+				break
+			}
+		}
+	}
+
+	return keys, nil
+}
+
 func valueToString[T any](value T) string {
 	if str, ok := any(value).(string); ok {
 		return str
@@ -63,10 +143,17 @@ func valueToString[T any](value T) string {
 }
 
 func stringToValue[T any](str string) (T, error) {
-	i, err := strconv.Atoi(str)
-	if err == nil {
+	var value T
+	switch any(value).(type) {
+	case int:
+		i, err := strconv.Atoi(str)
+		if err != nil {
+			return value, fmt.Errorf("%w %q: %w", ErrInvalidValue, str, err)
+		}
 		return any(i).(T), nil
+	case string:
+		return any(str).(T), nil
+	default:
+		return value, fmt.Errorf("%w: unsupported value type %T", ErrInvalidValue, value)
 	}
-
-	return any(str).(T), nil
 }
@@ -0,0 +1,45 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+
+	"calculator-otel/internal/observability"
+)
+
+// baggageHandler adds the allowed members of the request baggage to every
+// record.
+type baggageHandler struct {
+	slog.Handler
+	allowlist *observability.BaggageAllowlist
+}
+
+// NewBaggageHandler returns a handler that adds the members of the baggage
+// in the context allowed by allowlist to each record before passing it on to
+// handler. A nil allowlist returns handler itself.
+func NewBaggageHandler(handler slog.Handler, allowlist *observability.BaggageAllowlist) slog.Handler {
+	if allowlist == nil {
+		return handler
+	}
+
+	return baggageHandler{Handler: handler, allowlist: allowlist}
+}
+
+func (h baggageHandler) Handle(ctx context.Context, record slog.Record) error {
+	if attrs := h.allowlist.Attributes(ctx); len(attrs) > 0 {
+		record = record.Clone()
+		for _, attr := range attrs {
+			record.AddAttrs(slog.String(string(attr.Key), attr.Value.AsString()))
+		}
+	}
+
+	return h.Handler.Handle(ctx, record)
+}
+
+func (h baggageHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return baggageHandler{Handler: h.Handler.WithAttrs(attrs), allowlist: h.allowlist}
+}
+
+func (h baggageHandler) WithGroup(name string) slog.Handler {
+	return baggageHandler{Handler: h.Handler.WithGroup(name), allowlist: h.allowlist}
+}
@@ -0,0 +1,93 @@
+package logger
+
+import (
+	"context"
+	"log/slog"
+
+	"go.opentelemetry.io/otel/attribute"
+
+	"calculator-otel/internal/observability"
+)
+
+// redactingHandler redacts the attributes of records before passing them on.
+type redactingHandler struct {
+	slog.Handler
+	policy *observability.RedactionPolicy
+}
+
+// NewRedactingHandler returns a handler that redacts the attributes of each
+// record by policy before passing it on to handler. Attributes in groups are
+// matched by their own key. A nil policy returns handler itself.
+func NewRedactingHandler(handler slog.Handler, policy *observability.RedactionPolicy) slog.Handler {
+	if policy == nil {
+		return handler
+	}
+
+	return redactingHandler{Handler: handler, policy: policy}
+}
+
+func (h redactingHandler) Handle(ctx context.Context, record slog.Record) error {
+	redacted := slog.NewRecord(record.Time, record.Level, record.Message, record.PC)
+	record.Attrs(func(attr slog.Attr) bool {
+		if attr, ok := h.redact(attr); ok {
+			redacted.AddAttrs(attr)
+		}
+		return true
+	})
+
+	return h.Handler.Handle(ctx, redacted)
+}
+
+func (h redactingHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	redacted := make([]slog.Attr, 0, len(attrs))
+	for _, attr := range attrs {
+		if attr, ok := h.redact(attr); ok {
+			redacted = append(redacted, attr)
+		}
+	}
+
+	return redactingHandler{Handler: h.Handler.WithAttrs(redacted), policy: h.policy}
+}
+
+func (h redactingHandler) WithGroup(name string) slog.Handler {
+	return redactingHandler{Handler: h.Handler.WithGroup(name), policy: h.policy}
+}
+
+// redact applies the policy to attr. It reports false if attr is dropped.
+func (h redactingHandler) redact(attr slog.Attr) (slog.Attr, bool) {
+	attr.Value = attr.Value.Resolve()
+	if attr.Value.Kind() == slog.KindGroup {
+		var group []slog.Attr
+		for _, member := range attr.Value.Group() {
+			if member, ok := h.redact(member); ok {
+				group = append(group, member)
+			}
+		}
+		return slog.Attr{Key: attr.Key, Value: slog.GroupValue(group...)}, true
+	}
+	if h.policy.Action(attr.Key) == observability.RedactKeep {
+		return attr, true
+	}
+
+	kv, ok := h.policy.Redact(toAttribute(attr))
+	if !ok {
+		return attr, false
+	}
+
+	return slog.Any(attr.Key, kv.Value.AsInterface()), true
+}
+
+// toAttribute converts attr to an OpenTelemetry attribute, keeping numbers
+// as numbers so that they can be bucketed.
+func toAttribute(attr slog.Attr) attribute.KeyValue {
+	switch attr.Value.Kind() {
+	case slog.KindInt64:
+		return attribute.Int64(attr.Key, attr.Value.Int64())
+	case slog.KindUint64:
+		return attribute.Float64(attr.Key, float64(attr.Value.Uint64()))
+	case slog.KindFloat64:
+		return attribute.Float64(attr.Key, attr.Value.Float64())
+	default:
+		return attribute.String(attr.Key, attr.Value.String())
+	}
+}
@@ -0,0 +1,122 @@
+// Package metrics defines the application level instruments of the
+// calculator: rate, errors and duration of calculations, cache effectiveness
+// and history write failures.
+package metrics
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"calculator-otel/internal/observability"
+)
+
+// Outcomes of a calculation request.
+const (
+	OutcomeSuccess = "success"
+	// OutcomeInvalid is a request rejected because of its input.
+	OutcomeInvalid = "invalid"
+	OutcomeError   = "error"
+)
+
+// Results of a cache lookup.
+const (
+	CacheHit   = "hit"
+	CacheMiss  = "miss"
+	CacheError = "error"
+)
+
+// UnknownOperation is recorded instead of operations the service does not
+// support, keeping caller input out of attribute values.
+const UnknownOperation = "unknown"
+
+var (
+	// latencyBuckets suit both sub-microsecond computations and requests
+	// that wait on the cache and database.
+	latencyBuckets = []float64{1e-7, 1e-6, 1e-5, 1e-4, 5e-4, 1e-3, 5e-3, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5}
+	// magnitudeBuckets are powers of ten up to the int64 range.
+	magnitudeBuckets = []float64{0, 1, 10, 100, 1e3, 1e4, 1e5, 1e6, 1e9, 1e12, 1e15, 1e18}
+)
+
+type Metrics struct {
+	calculations     metric.Int64Counter
+	requestDuration  metric.Float64Histogram
+	computeDuration  metric.Float64Histogram
+	cacheLookups     metric.Int64Counter
+	historyFailures  metric.Int64Counter
+	operandMagnitude metric.Float64Histogram
+
+	baggage *observability.BaggageAllowlist
+}
+
+// New creates the instruments on meter. Measurements also carry the members
+// of the request baggage allowed by baggage, which may be nil.
+func New(meter metric.Meter, baggage *observability.BaggageAllowlist) (*Metrics, error) {
+	m := &Metrics{baggage: baggage}
+
+	var err error
+	if m.calculations, err = meter.Int64Counter("calculator.calculations",
+		metric.WithUnit("{calculation}"), metric.WithDescription("Calculation requests, by operation and outcome")); err != nil {
+		return nil, err
+	}
+	if m.requestDuration, err = meter.Float64Histogram("calculator.request.duration",
+		metric.WithUnit("s"), metric.WithDescription("End-to-end time taken to serve a calculation request"),
+		metric.WithExplicitBucketBoundaries(latencyBuckets...)); err != nil {
+		return nil, err
+	}
+	if m.computeDuration, err = meter.Float64Histogram("calculator.compute.duration",
+		metric.WithUnit("s"), metric.WithDescription("Time taken to compute a result that was not cached"),
+		metric.WithExplicitBucketBoundaries(latencyBuckets...)); err != nil {
+		return nil, err
+	}
+	if m.cacheLookups, err = meter.Int64Counter("calculator.cache.lookups",
+		metric.WithUnit("{lookup}"), metric.WithDescription("Cache lookups for calculation results, by result")); err != nil {
+		return nil, err
+	}
+	if m.historyFailures, err = meter.Int64Counter("calculator.history.write.failures",
+		metric.WithUnit("{record}"), metric.WithDescription("Calculations whose history could not be written")); err != nil {
+		return nil, err
+	}
+	if m.operandMagnitude, err = meter.Float64Histogram("calculator.operand.magnitude",
+		metric.WithUnit("1"), metric.WithDescription("Absolute value of calculation operands"),
+		metric.WithExplicitBucketBoundaries(magnitudeBuckets...)); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// RecordRequest records a calculation request that took duration end to end.
+func (m *Metrics) RecordRequest(ctx context.Context, operation, outcome string, duration time.Duration) {
+	attrs := m.attributes(ctx, attribute.String("operation", operation), attribute.String("outcome", outcome))
+	m.calculations.Add(ctx, 1, attrs)
+	m.requestDuration.Record(ctx, duration.Seconds(), attrs)
+}
+
+func (m *Metrics) RecordCompute(ctx context.Context, operation string, duration time.Duration) {
+	m.computeDuration.Record(ctx, duration.Seconds(), m.attributes(ctx, attribute.String("operation", operation)))
+}
+
+// RecordCacheLookup records a lookup with one of the Cache results.
+func (m *Metrics) RecordCacheLookup(ctx context.Context, operation, result string) {
+	m.cacheLookups.Add(ctx, 1, m.attributes(ctx, attribute.String("operation", operation), attribute.String("result", result)))
+}
+
+func (m *Metrics) RecordHistoryFailure(ctx context.Context, operation string) {
+	m.historyFailures.Add(ctx, 1, m.attributes(ctx, attribute.String("operation", operation)))
+}
+
+func (m *Metrics) RecordOperands(ctx context.Context, operation string, a, b int) {
+	attrs := m.attributes(ctx, attribute.String("operation", operation))
+	m.operandMagnitude.Record(ctx, math.Abs(float64(a)), attrs)
+	m.operandMagnitude.Record(ctx, math.Abs(float64(b)), attrs)
+}
+
+// attributes returns attrs together with the allowed baggage members of ctx,
+// capped as set by the allowlist. Where keys clash, attrs take precedence.
+func (m *Metrics) attributes(ctx context.Context, attrs ...attribute.KeyValue) metric.MeasurementOption {
+	return metric.WithAttributes(append(m.baggage.MetricAttributes(ctx), attrs...)...)
+}
@@ -0,0 +1,120 @@
+package observability
+
+import (
+	"context"
+	"sync"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/baggage"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// BaggageOtherValue replaces the values of a baggage key on metrics once the
+// key has reached its limit of distinct values.
+const BaggageOtherValue = "other"
+
+// BaggageAllowlist selects the W3C baggage members that are copied onto
+// spans, log records and metrics. Members are copied under their own key, so
+// a key should not clash with an attribute the server sets itself.
+//
+// Baggage is set by callers, so the values copied onto metrics are capped:
+// each key keeps the first metricValues distinct values it sees, and records
+// any other as BaggageOtherValue. With no cap, baggage is left off metrics.
+type BaggageAllowlist struct {
+	keys         []string
+	metricValues int
+
+	mu   sync.Mutex
+	seen map[string]map[string]struct{}
+}
+
+// NewBaggageAllowlist returns an allowlist of keys that records up to
+// metricValues distinct values of each key on metrics, or nil when keys is
+// empty. A nil allowlist copies nothing.
+func NewBaggageAllowlist(keys []string, metricValues int) *BaggageAllowlist {
+	if len(keys) == 0 {
+		return nil
+	}
+
+	return &BaggageAllowlist{
+		keys:         keys,
+		metricValues: metricValues,
+		seen:         make(map[string]map[string]struct{}),
+	}
+}
+
+// Attributes returns the allowed members of the baggage in ctx, in the order
+// of the allowlist.
+func (b *BaggageAllowlist) Attributes(ctx context.Context) []attribute.KeyValue {
+	if b == nil {
+		return nil
+	}
+
+	bag := baggage.FromContext(ctx)
+	if bag.Len() == 0 {
+		return nil
+	}
+
+	var attrs []attribute.KeyValue
+	for _, key := range b.keys {
+		if member := bag.Member(key); member.Key() != "" {
+			attrs = append(attrs, attribute.String(key, member.Value()))
+		}
+	}
+
+	return attrs
+}
+
+// MetricAttributes returns the allowed members of the baggage in ctx as metric
+// attributes, with the values past the limit of their key replaced by
+// BaggageOtherValue. It returns nothing when baggage is kept off metrics.
+func (b *BaggageAllowlist) MetricAttributes(ctx context.Context) []attribute.KeyValue {
+	if b == nil || b.metricValues <= 0 {
+		return nil
+	}
+
+	attrs := b.Attributes(ctx)
+	if len(attrs) == 0 {
+		return nil
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for i, attr := range attrs {
+		key, value := string(attr.Key), attr.Value.AsString()
+		values, ok := b.seen[key]
+		if !ok {
+			values = make(map[string]struct{})
+			b.seen[key] = values
+		}
+		if _, ok := values[value]; ok {
+			continue
+		}
+		if len(values) < b.metricValues {
+			values[value] = struct{}{}
+			continue
+		}
+		attrs[i] = attribute.String(key, BaggageOtherValue)
+	}
+
+	return attrs
+}
+
+// baggageSpanProcessor sets the allowed baggage members as attributes of
+// every span when it starts.
+type baggageSpanProcessor struct {
+	allowlist *BaggageAllowlist
+}
+
+func (p baggageSpanProcessor) OnStart(ctx context.Context, s trace.ReadWriteSpan) {
+	if attrs := p.allowlist.Attributes(ctx); len(attrs) > 0 {
+		s.SetAttributes(attrs...)
+	}
+}
+
+func (baggageSpanProcessor) OnEnd(trace.ReadOnlySpan) {}
+
+func (baggageSpanProcessor) Shutdown(context.Context) error { return nil }
+
+func (baggageSpanProcessor) ForceFlush(context.Context) error { return nil }
@@ -0,0 +1,302 @@
+package observability
+
+import (
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"go.opentelemetry.io/contrib/instrumentation/runtime"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploghttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetrichttp"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	otelprometheus "go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutlog"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Exporters selectable for each signal, named as in OTEL_TRACES_EXPORTER,
+// OTEL_METRICS_EXPORTER and OTEL_LOGS_EXPORTER.
+const (
+	ExporterOTLP    = "otlp"
+	ExporterConsole = "console"
+	// ExporterStdout is an alias of ExporterConsole.
+	ExporterStdout = "stdout"
+	// ExporterPrometheus serves metrics for Prometheus to scrape instead of
+	// pushing them. It is only valid for metrics.
+	ExporterPrometheus = "prometheus"
+	ExporterNone       = "none"
+)
+
+// OTLP protocols, named as in OTEL_EXPORTER_OTLP_PROTOCOL.
+const (
+	ProtocolGRPC = "grpc"
+	ProtocolHTTP = "http/protobuf"
+)
+
+// Default export intervals, used unless OTEL_METRIC_EXPORT_INTERVAL or
+// OTEL_BLRP_SCHEDULE_DELAY is set.
+const (
+	defaultMetricInterval = 10 * time.Second
+	defaultLogInterval    = 5 * time.Second
+)
+
+type SignalConfig struct {
+	// Exporter is one of the Exporter constants; empty selects ExporterOTLP.
+	Exporter string
+	// Protocol is the OTLP protocol, ProtocolGRPC or ProtocolHTTP; empty
+	// selects ProtocolGRPC.
+	Protocol string
+}
+
+// exporters builds the exporters of each signal. Endpoints, headers, TLS
+// certificates, timeouts and compression of the OTLP exporters are read from
+// the standard OTEL_EXPORTER_OTLP_* variables by the exporters themselves.
+type exporters struct {
+	fallback      *fallbackExporters
+	probeInterval time.Duration
+	probes        map[string]*collectorProbe
+	// runtime produces the Go scheduling latency histogram for every
+	// metric reader.
+	runtime metric.Producer
+}
+
+func newExporters(fallback FallbackConfig) (*exporters, error) {
+	fallbackExporters, err := newFallbackExporters(fallback.Mode)
+	if err != nil {
+		return nil, err
+	}
+
+	return &exporters{
+		fallback:      fallbackExporters,
+		probeInterval: fallback.ProbeInterval,
+		probes:        make(map[string]*collectorProbe),
+		runtime:       runtime.NewProducer(),
+	}, nil
+}
+
+// probe returns the probe of the collector at addr, shared by every signal
+// exported there.
+func (e *exporters) probe(addr string) *collectorProbe {
+	probe, ok := e.probes[addr]
+	if !ok {
+		probe = newCollectorProbe(addr, e.probeInterval)
+		e.probes[addr] = probe
+	}
+
+	return probe
+}
+
+// spanExporter returns the exporter selected for traces, or nil for none.
+func (e *exporters) spanExporter(ctx context.Context, config SignalConfig) (trace.SpanExporter, error) {
+	switch cmp.Or(config.Exporter, ExporterOTLP) {
+	case ExporterOTLP:
+		var exporter trace.SpanExporter
+		var err error
+		switch protocol := cmp.Or(config.Protocol, ProtocolGRPC); protocol {
+		case ProtocolGRPC:
+			var options []otlptracegrpc.Option
+			if !endpointConfigured("TRACES") {
+				options = append(options, otlptracegrpc.WithInsecure())
+			}
+			exporter, err = otlptracegrpc.New(ctx, options...)
+		case ProtocolHTTP:
+			var options []otlptracehttp.Option
+			if !endpointConfigured("TRACES") {
+				options = append(options, otlptracehttp.WithInsecure())
+			}
+			exporter, err = otlptracehttp.New(ctx, options...)
+		default:
+			return nil, fmt.Errorf("unknown OTLP protocol %q", protocol)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to create trace exporter: %w", err)
+		}
+		return &failoverSpanExporter{
+			probe:    e.probe(collectorAddr("TRACES", config.Protocol)),
+			primary:  exporter,
+			fallback: e.fallback.traces,
+		}, nil
+	case ExporterConsole, ExporterStdout:
+		return stdouttrace.New()
+	case ExporterNone:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unsupported trace exporter %q", config.Exporter)
+	}
+}
+
+// metricReader returns the reader selected for metrics, or nil for none.
+// The Prometheus exporter serves its metrics on mux.
+func (e *exporters) metricReader(ctx context.Context, config SignalConfig, mux *http.ServeMux) (metric.Reader, error) {
+	readerOptions := []metric.PeriodicReaderOption{metric.WithProducer(e.runtime)}
+	if os.Getenv("OTEL_METRIC_EXPORT_INTERVAL") == "" {
+		readerOptions = append(readerOptions, metric.WithInterval(defaultMetricInterval))
+	}
+
+	switch cmp.Or(config.Exporter, ExporterOTLP) {
+	case ExporterOTLP:
+		var exporter metric.Exporter
+		var err error
+		switch protocol := cmp.Or(config.Protocol, ProtocolGRPC); protocol {
+		case ProtocolGRPC:
+			var options []otlpmetricgrpc.Option
+			if !endpointConfigured("METRICS") {
+				options = append(options, otlpmetricgrpc.WithInsecure())
+			}
+			exporter, err = otlpmetricgrpc.New(ctx, options...)
+		case ProtocolHTTP:
+			var options []otlpmetrichttp.Option
+			if !endpointConfigured("METRICS") {
+				options = append(options, otlpmetrichttp.WithInsecure())
+			}
+			exporter, err = otlpmetrichttp.New(ctx, options...)
+		default:
+			return nil, fmt.Errorf("unknown OTLP protocol %q", protocol)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to create metric exporter: %w", err)
+		}
+		return metric.NewPeriodicReader(&failoverMetricExporter{
+			probe:    e.probe(collectorAddr("METRICS", config.Protocol)),
+			primary:  exporter,
+			fallback: e.fallback.metrics,
+		}, readerOptions...), nil
+	case ExporterConsole, ExporterStdout:
+		exporter, err := stdoutmetric.New()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create metric exporter: %w", err)
+		}
+		return metric.NewPeriodicReader(exporter, readerOptions...), nil
+	case ExporterPrometheus:
+		return e.prometheusReader(mux)
+	case ExporterNone:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unsupported metric exporter %q", config.Exporter)
+	}
+}
+
+// prometheusReader returns a reader that serves metrics for Prometheus to
+// scrape at /metrics on mux, in the OpenMetrics format so that histogram
+// buckets carry exemplars linking them to traces. Go runtime metrics come
+// from the OpenTelemetry runtime instrumentation like with every other
+// exporter, so the Prometheus Go and process collectors are not registered.
+func (e *exporters) prometheusReader(mux *http.ServeMux) (metric.Reader, error) {
+	if mux == nil {
+		return nil, errors.New("the Prometheus exporter needs an admin endpoint to serve metrics on")
+	}
+
+	registry := prometheus.NewRegistry()
+	exporter, err := otelprometheus.New(
+		otelprometheus.WithRegisterer(registry),
+		otelprometheus.WithProducer(e.runtime),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create Prometheus exporter: %w", err)
+	}
+
+	mux.Handle("GET /metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{
+		Registry:          registry,
+		EnableOpenMetrics: true,
+	}))
+
+	return exporter, nil
+}
+
+// logExporter returns the exporter selected for logs, or nil for none.
+func (e *exporters) logExporter(ctx context.Context, config SignalConfig) (log.Exporter, error) {
+	switch cmp.Or(config.Exporter, ExporterOTLP) {
+	case ExporterOTLP:
+		var exporter log.Exporter
+		var err error
+		switch protocol := cmp.Or(config.Protocol, ProtocolGRPC); protocol {
+		case ProtocolGRPC:
+			var options []otlploggrpc.Option
+			if !endpointConfigured("LOGS") {
+				options = append(options, otlploggrpc.WithInsecure())
+			}
+			exporter, err = otlploggrpc.New(ctx, options...)
+		case ProtocolHTTP:
+			var options []otlploghttp.Option
+			if !endpointConfigured("LOGS") {
+				options = append(options, otlploghttp.WithInsecure())
+			}
+			exporter, err = otlploghttp.New(ctx, options...)
+		default:
+			return nil, fmt.Errorf("unknown OTLP protocol %q", protocol)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to create log exporter: %w", err)
+		}
+		return &failoverLogExporter{
+			probe:    e.probe(collectorAddr("LOGS", config.Protocol)),
+			primary:  exporter,
+			fallback: e.fallback.logs,
+		}, nil
+	case ExporterConsole, ExporterStdout:
+		return stdoutlog.New()
+	case ExporterNone:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("unsupported log exporter %q", config.Exporter)
+	}
+}
+
+// Close stops the collector probes.
+func (e *exporters) Close() {
+	for _, probe := range e.probes {
+		probe.Close()
+	}
+}
+
+// endpointConfigured reports whether the collector endpoint of signal is set.
+// Without one, the exporters talk plaintext to a local collector, as they
+// always have; with one, its scheme and OTEL_EXPORTER_OTLP_INSECURE decide.
+func endpointConfigured(signal string) bool {
+	return otlpEndpoint(signal) != ""
+}
+
+func otlpEndpoint(signal string) string {
+	return cmp.Or(os.Getenv("OTEL_EXPORTER_OTLP_"+signal+"_ENDPOINT"), os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT"))
+}
+
+// collectorAddr returns the host:port of the collector that signal is
+// exported to over protocol. The endpoint may be a URL or a bare address.
+func collectorAddr(signal, protocol string) string {
+	port := "4317"
+	if protocol == ProtocolHTTP {
+		port = "4318"
+	}
+
+	endpoint := otlpEndpoint(signal)
+	if endpoint == "" {
+		return net.JoinHostPort("localhost", port)
+	}
+
+	if strings.Contains(endpoint, "://") {
+		if u, err := url.Parse(endpoint); err == nil {
+			endpoint = u.Host
+		}
+	}
+	if _, _, err := net.SplitHostPort(endpoint); err != nil {
+		endpoint = net.JoinHostPort(endpoint, port)
+	}
+
+	return endpoint
+}
@@ -0,0 +1,264 @@
+package observability
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutlog"
+	"go.opentelemetry.io/otel/exporters/stdout/stdoutmetric"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/log"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Where telemetry goes while the collector is unreachable.
+const (
+	FallbackNone   = "none"
+	FallbackStdout = "stdout"
+)
+
+type FallbackConfig struct {
+	// Mode is FallbackNone, which drops telemetry, or FallbackStdout, which
+	// writes traces, metrics and logs to stdout.
+	Mode string
+	// ProbeInterval is how often an unreachable collector is probed.
+	ProbeInterval time.Duration
+}
+
+// collectorProbe tracks whether the collector accepts connections. Exporters
+// stop sending to the collector as soon as an export fails, and the probe
+// reconnects them once the collector is reachable again.
+type collectorProbe struct {
+	addr     string
+	interval time.Duration
+	up       atomic.Bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newCollectorProbe(addr string, interval time.Duration) *collectorProbe {
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+
+	p := &collectorProbe{
+		addr:     addr,
+		interval: interval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if p.reachable() {
+		p.up.Store(true)
+	} else {
+		slog.Warn("OpenTelemetry collector is unreachable, using fallback exporters", "address", addr)
+	}
+	go p.run()
+
+	return p
+}
+
+func (p *collectorProbe) Up() bool {
+	return p.up.Load()
+}
+
+// markDown switches the exporters to their fallbacks after err.
+func (p *collectorProbe) markDown(err error) {
+	if p.up.CompareAndSwap(true, false) {
+		slog.Warn("failed to export to the OpenTelemetry collector, using fallback exporters", "address", p.addr, "error", err)
+	}
+}
+
+func (p *collectorProbe) run() {
+	defer close(p.done)
+
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-p.stop:
+			return
+		case <-ticker.C:
+			if !p.Up() && p.reachable() {
+				p.up.Store(true)
+				slog.Info("OpenTelemetry collector is reachable again", "address", p.addr)
+			}
+		}
+	}
+}
+
+func (p *collectorProbe) reachable() bool {
+	conn, err := net.DialTimeout("tcp", p.addr, time.Second)
+	if err != nil {
+		return false
+	}
+	conn.Close()
+
+	return true
+}
+
+func (p *collectorProbe) Close() {
+	close(p.stop)
+	<-p.done
+}
+
+// fallbackExporters are used while the collector is down. A nil exporter
+// drops what it is given.
+type fallbackExporters struct {
+	traces  trace.SpanExporter
+	metrics metric.Exporter
+	logs    log.Exporter
+}
+
+func newFallbackExporters(mode string) (*fallbackExporters, error) {
+	switch mode {
+	case "", FallbackNone:
+		return &fallbackExporters{}, nil
+	case FallbackStdout:
+		traces, err := stdouttrace.New()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create stdout trace exporter: %w", err)
+		}
+		metrics, err := stdoutmetric.New()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create stdout metric exporter: %w", err)
+		}
+		logs, err := stdoutlog.New()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create stdout log exporter: %w", err)
+		}
+		return &fallbackExporters{traces: traces, metrics: metrics, logs: logs}, nil
+	default:
+		return nil, fmt.Errorf("unknown telemetry fallback %q", mode)
+	}
+}
+
+// failoverSpanExporter sends spans to primary while the collector is up and to
+// fallback otherwise.
+type failoverSpanExporter struct {
+	probe    *collectorProbe
+	primary  trace.SpanExporter
+	fallback trace.SpanExporter
+}
+
+func (e *failoverSpanExporter) ExportSpans(ctx context.Context, spans []trace.ReadOnlySpan) error {
+	if e.probe.Up() {
+		err := e.primary.ExportSpans(ctx, spans)
+		if err == nil {
+			return nil
+		}
+		e.probe.markDown(err)
+	}
+	if e.fallback == nil {
+		return nil
+	}
+
+	return e.fallback.ExportSpans(ctx, spans)
+}
+
+func (e *failoverSpanExporter) Shutdown(ctx context.Context) error {
+	err := e.primary.Shutdown(ctx)
+	if e.fallback != nil {
+		err = errors.Join(err, e.fallback.Shutdown(ctx))
+	}
+
+	return err
+}
+
+// failoverMetricExporter sends metrics to primary while the collector is up
+// and to fallback otherwise. Temporality and aggregation follow primary.
+type failoverMetricExporter struct {
+	probe    *collectorProbe
+	primary  metric.Exporter
+	fallback metric.Exporter
+}
+
+func (e *failoverMetricExporter) Temporality(kind metric.InstrumentKind) metricdata.Temporality {
+	return e.primary.Temporality(kind)
+}
+
+func (e *failoverMetricExporter) Aggregation(kind metric.InstrumentKind) metric.Aggregation {
+	return e.primary.Aggregation(kind)
+}
+
+func (e *failoverMetricExporter) Export(ctx context.Context, rm *metricdata.ResourceMetrics) error {
+	if e.probe.Up() {
+		err := e.primary.Export(ctx, rm)
+		if err == nil {
+			return nil
+		}
+		e.probe.markDown(err)
+	}
+	if e.fallback == nil {
+		return nil
+	}
+
+	return e.fallback.Export(ctx, rm)
+}
+
+func (e *failoverMetricExporter) ForceFlush(ctx context.Context) error {
+	err := e.primary.ForceFlush(ctx)
+	if e.fallback != nil {
+		err = errors.Join(err, e.fallback.ForceFlush(ctx))
+	}
+
+	return err
+}
+
+func (e *failoverMetricExporter) Shutdown(ctx context.Context) error {
+	err := e.primary.Shutdown(ctx)
+	if e.fallback != nil {
+		err = errors.Join(err, e.fallback.Shutdown(ctx))
+	}
+
+	return err
+}
+
+// failoverLogExporter sends log records to primary while the collector is up
+// and to fallback otherwise.
+type failoverLogExporter struct {
+	probe    *collectorProbe
+	primary  log.Exporter
+	fallback log.Exporter
+}
+
+func (e *failoverLogExporter) Export(ctx context.Context, records []log.Record) error {
+	if e.probe.Up() {
+		err := e.primary.Export(ctx, records)
+		if err == nil {
+			return nil
+		}
+		e.probe.markDown(err)
+	}
+	if e.fallback == nil {
+		return nil
+	}
+
+	return e.fallback.Export(ctx, records)
+}
+
+func (e *failoverLogExporter) ForceFlush(ctx context.Context) error {
+	err := e.primary.ForceFlush(ctx)
+	if e.fallback != nil {
+		err = errors.Join(err, e.fallback.ForceFlush(ctx))
+	}
+
+	return err
+}
+
+func (e *failoverLogExporter) Shutdown(ctx context.Context) error {
+	err := e.primary.Shutdown(ctx)
+	if e.fallback != nil {
+		err = errors.Join(err, e.fallback.Shutdown(ctx))
+	}
+
+	return err
+}
@@ -2,15 +2,15 @@ package observability
 
 import (
 	"context"
-	"fmt"
+	"errors"
 	"log/slog"
-	"time"
+	"net/http"
+	"os"
+	"slices"
 
 	"go.opentelemetry.io/otel"
-	"go.opentelemetry.io/otel/exporters/otlp/otlplog/otlploggrpc"
-	"go.opentelemetry.io/otel/exporters/otlp/otlpmetric/otlpmetricgrpc"
-	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
 	"go.opentelemetry.io/otel/log/global"
+	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/log"
 	"go.opentelemetry.io/otel/sdk/metric"
 	"go.opentelemetry.io/otel/sdk/resource"
@@ -18,63 +18,206 @@ import (
 	semconv "go.opentelemetry.io/otel/semconv/v1.32.0"
 )
 
-func InitOpenTelemetry(
-	ctx context.Context,
-	appName, version, environment string,
-) (func(context.Context) error, error) {
-	resource, err := resource.New(
+type Config struct {
+	ServiceName    string
+	ServiceVersion string
+	Environment    string
+
+	Traces  SignalConfig
+	Metrics SignalConfig
+	Logs    SignalConfig
+
+	// Sampler decides which traces are recorded. Nil samples every trace.
+	Sampler *Sampler
+	// Baggage selects the baggage members set as attributes of every span.
+	Baggage *BaggageAllowlist
+	// Redaction redacts span and metric attributes before they are
+	// exported. Nil redacts nothing.
+	Redaction *RedactionPolicy
+	// Limits bound the attributes of spans and log records.
+	Limits AttributeLimits
+
+	// Prometheus adds a reader serving metrics for Prometheus to scrape,
+	// alongside the exporter selected for metrics.
+	Prometheus bool
+	// AdminMux receives the /metrics endpoint of the Prometheus reader and
+	// the debug pages.
+	AdminMux *http.ServeMux
+	Debug    DebugConfig
+
+	Fallback FallbackConfig
+}
+
+// InitOpenTelemetry sets up the global log, trace and meter providers with
+// the exporters selected by config, and the W3C trace context and baggage
+// propagators. While the collector is unreachable, OTLP telemetry goes to the
+// fallback exporters instead.
+func InitOpenTelemetry(ctx context.Context, config Config) (func(context.Context) error, error) {
+	// Set first, so that requests are still joined to their callers' traces
+	// when the providers cannot be set up.
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+
+	// The process command line is left out, as flags may carry passwords.
+	// OTEL_RESOURCE_ATTRIBUTES overrides anything detected.
+	res, err := resource.New(
 		ctx,
+		resource.WithTelemetrySDK(),
+		resource.WithHost(),
+		resource.WithOS(),
+		resource.WithContainer(),
+		resource.WithProcessPID(),
+		resource.WithProcessExecutableName(),
+		resource.WithProcessOwner(),
+		resource.WithProcessRuntimeName(),
+		resource.WithProcessRuntimeVersion(),
+		resource.WithProcessRuntimeDescription(),
+		resource.WithFromEnv(),
 		resource.WithAttributes(
-			semconv.ServiceNameKey.String(appName),
-			semconv.ServiceVersionKey.String(version),
-			semconv.DeploymentEnvironmentName(environment),
+			semconv.ServiceNameKey.String(config.ServiceName),
+			semconv.ServiceVersionKey.String(config.ServiceVersion),
+			semconv.DeploymentEnvironmentName(config.Environment),
 		),
 	)
-	if err != nil {
+	if errors.Is(err, resource.ErrPartialResource) {
+		// Detectors that fail, such as the container one outside a container,
+		// only leave their attributes out.
+		slog.Warn("failed to detect some resource attributes", "error", err)
+	} else if err != nil {
 		return nil, err
 	}
 
-	logExporter, err := otlploggrpc.New(ctx, otlploggrpc.WithInsecure())
+	if config.Debug.Enabled && config.AdminMux == nil {
+		return nil, errors.New("the debug pages need an admin endpoint to be served on")
+	}
+
+	exporters, err := newExporters(config.Fallback)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create log exporter: %w", err)
+		return nil, err
 	}
 
-	logProcessor := log.NewBatchProcessor(logExporter, log.WithExportInterval(5*time.Second))
+	// Exporters that were created before an error are shut down, so that
+	// their connections and the collector probes do not outlive the failed
+	// setup. Nothing can fail once the providers are created.
+	var created []func(context.Context) error
+	fail := func(err error) (func(context.Context) error, error) {
+		for _, shutdown := range slices.Backward(created) {
+			if shutdownErr := shutdown(ctx); shutdownErr != nil {
+				slog.Warn("failed to shut down telemetry exporter", "error", shutdownErr)
+			}
+		}
+		exporters.Close()
+		return nil, err
+	}
 
-	logProvider := log.NewLoggerProvider(
-		log.WithResource(resource),
-		log.WithProcessor(logProcessor),
-	)
+	logExporter, err := exporters.logExporter(ctx, config.Logs)
+	if err != nil {
+		return fail(err)
+	}
+	if logExporter != nil {
+		created = append(created, logExporter.Shutdown)
+	}
 
-	global.SetLoggerProvider(logProvider)
+	traceExporter, err := exporters.spanExporter(ctx, config.Traces)
+	if err != nil {
+		return fail(err)
+	}
+	if traceExporter != nil {
+		created = append(created, traceExporter.Shutdown)
+	}
 
-	traceExporter, err := otlptracegrpc.New(ctx, otlptracegrpc.WithInsecure())
+	metricReader, err := exporters.metricReader(ctx, config.Metrics, config.AdminMux)
 	if err != nil {
-		return nil, fmt.Errorf("failed to create trace exporter: %w", err)
+		return fail(err)
+	}
+	if metricReader != nil {
+		created = append(created, metricReader.Shutdown)
+	}
+	var scrapeReader metric.Reader
+	if config.Prometheus && config.Metrics.Exporter != ExporterPrometheus {
+		scrapeReader, err = exporters.prometheusReader(config.AdminMux)
+		if err != nil {
+			return fail(err)
+		}
 	}
 
-	traceProvider := trace.NewTracerProvider(
-		trace.WithResource(resource),
-		trace.WithBatcher(traceExporter),
-	)
+	logOptions := []log.LoggerProviderOption{log.WithResource(res)}
+	if config.Limits.Count != 0 {
+		logOptions = append(logOptions, log.WithAttributeCountLimit(config.Limits.Count))
+	}
+	if config.Limits.ValueLength != 0 {
+		logOptions = append(logOptions, log.WithAttributeValueLengthLimit(config.Limits.ValueLength))
+	}
+	if logExporter != nil {
+		var processorOptions []log.BatchProcessorOption
+		if os.Getenv("OTEL_BLRP_SCHEDULE_DELAY") == "" {
+			processorOptions = append(processorOptions, log.WithExportInterval(defaultLogInterval))
+		}
+		logOptions = append(logOptions, log.WithProcessor(log.NewBatchProcessor(logExporter, processorOptions...)))
+	}
+	logProvider := log.NewLoggerProvider(logOptions...)
 
-	otel.SetTracerProvider(traceProvider)
+	global.SetLoggerProvider(logProvider)
 
-	metricExporter, err := otlpmetricgrpc.New(ctx, otlpmetricgrpc.WithInsecure())
-	if err != nil {
-		return nil, err
+	// Other span limits are still read from OTEL_SPAN_* variables.
+	spanLimits := trace.NewSpanLimits()
+	if config.Limits.Count != 0 {
+		spanLimits.AttributeCountLimit = config.Limits.Count
+	}
+	if config.Limits.ValueLength != 0 {
+		spanLimits.AttributeValueLengthLimit = config.Limits.ValueLength
 	}
 
-	reader := metric.NewPeriodicReader(metricExporter, metric.WithInterval(10*time.Second))
+	traceOptions := []trace.TracerProviderOption{trace.WithResource(res), trace.WithRawSpanLimits(spanLimits)}
+	if config.Sampler != nil {
+		traceOptions = append(traceOptions, trace.WithSampler(config.Sampler))
+	}
+	if config.Baggage != nil {
+		traceOptions = append(traceOptions, trace.WithSpanProcessor(baggageSpanProcessor{config.Baggage}))
+	}
+	if traceExporter != nil {
+		var processor trace.SpanProcessor = trace.NewBatchSpanProcessor(traceExporter)
+		if config.Redaction != nil {
+			processor = redactingSpanProcessor{SpanProcessor: processor, policy: config.Redaction}
+		}
+		traceOptions = append(traceOptions, trace.WithSpanProcessor(errorSpanProcessor{processor}))
+	}
+	if config.Debug.Enabled {
+		store := newSpanStore()
+		var processor trace.SpanProcessor = store
+		if config.Redaction != nil {
+			processor = redactingSpanProcessor{SpanProcessor: processor, policy: config.Redaction}
+		}
+		traceOptions = append(traceOptions, trace.WithSpanProcessor(processor))
+		(&debugPages{store: store, jaegerURL: config.Debug.JaegerURL}).register(config.AdminMux)
+	}
+	traceProvider := trace.NewTracerProvider(traceOptions...)
 
-	mp := metric.NewMeterProvider(
-		metric.WithResource(resource),
-		metric.WithReader(reader),
-	)
+	otel.SetTracerProvider(traceProvider)
+
+	metricOptions := []metric.Option{metric.WithResource(res)}
+	if config.Redaction != nil {
+		metricOptions = append(metricOptions, metric.WithView(config.Redaction.view()))
+	}
+	if metricReader != nil {
+		metricOptions = append(metricOptions, metric.WithReader(metricReader))
+	}
+	if scrapeReader != nil {
+		metricOptions = append(metricOptions, metric.WithReader(scrapeReader))
+	}
+	mp := metric.NewMeterProvider(metricOptions...)
 
 	otel.SetMeterProvider(mp)
 
+	if err := startRuntimeMetrics(mp); err != nil {
+		slog.Error("Error starting runtime metrics", "error", err)
+	}
+
 	return func(ctx context.Context) error {
+		defer exporters.Close()
+
 		shutdownErr := logProvider.Shutdown(ctx)
 		if shutdownErr != nil {
 			slog.Error("Error shutting down log provider", "error", shutdownErr)
@@ -93,3 +236,14 @@ func InitOpenTelemetry(
 		return shutdownErr
 	}, nil
 }
+
+// InstanceID returns the service.instance.id set in OTEL_RESOURCE_ATTRIBUTES,
+// falling back to the host name so that replicas remain distinguishable.
+func InstanceID() string {
+	if value, ok := resource.Environment().Set().Value(semconv.ServiceInstanceIDKey); ok && value.AsString() != "" {
+		return value.AsString()
+	}
+
+	hostname, _ := os.Hostname()
+	return hostname
+}
@@ -0,0 +1,208 @@
+package observability
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// Redaction actions applied to an attribute.
+const (
+	RedactKeep = "keep"
+	RedactDrop = "drop"
+	// RedactHash replaces the value with a keyed hash, which still groups
+	// equal values together.
+	RedactHash = "hash"
+	// RedactBucket replaces a number with its order of magnitude, such as
+	// "[100,1000)". Values that are not numbers are dropped.
+	RedactBucket = "bucket"
+)
+
+// RedactionPolicy decides, per attribute key, how attributes are redacted
+// before spans, log records and metrics leave the process. Keys without a
+// rule are kept.
+type RedactionPolicy struct {
+	rules   map[string]string
+	hashKey []byte
+}
+
+// ParseRedactionPolicy parses rules written as
+// "calculator.input1=bucket,cache.key=hash", hashing with hashKey. It returns
+// nil, which redacts nothing, when there are no rules.
+func ParseRedactionPolicy(spec, hashKey string) (*RedactionPolicy, error) {
+	rules := make(map[string]string)
+	for entry := range strings.SplitSeq(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		key, action, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid redaction rule %q: expected key=action", entry)
+		}
+		switch action = strings.TrimSpace(action); action {
+		case RedactKeep, RedactDrop, RedactHash, RedactBucket:
+			rules[strings.TrimSpace(key)] = action
+		default:
+			return nil, fmt.Errorf("unknown redaction action %q for key %s", action, key)
+		}
+	}
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	return &RedactionPolicy{rules: rules, hashKey: []byte(hashKey)}, nil
+}
+
+// Action returns the action of the rule for key.
+func (p *RedactionPolicy) Action(key string) string {
+	if p == nil {
+		return RedactKeep
+	}
+	if action, ok := p.rules[key]; ok {
+		return action
+	}
+
+	return RedactKeep
+}
+
+// Redact applies the rule for its key to kv. It reports false if kv is
+// dropped.
+func (p *RedactionPolicy) Redact(kv attribute.KeyValue) (attribute.KeyValue, bool) {
+	switch p.Action(string(kv.Key)) {
+	case RedactDrop:
+		return kv, false
+	case RedactHash:
+		return kv.Key.String(p.hash(kv.Value.Emit())), true
+	case RedactBucket:
+		var value float64
+		switch kv.Value.Type() {
+		case attribute.INT64:
+			value = float64(kv.Value.AsInt64())
+		case attribute.FLOAT64:
+			value = kv.Value.AsFloat64()
+		default:
+			return kv, false
+		}
+		return kv.Key.String(magnitudeBucket(value)), true
+	default:
+		return kv, true
+	}
+}
+
+// RedactAll applies Redact to each of attrs. It returns attrs itself when
+// nothing is redacted.
+func (p *RedactionPolicy) RedactAll(attrs []attribute.KeyValue) []attribute.KeyValue {
+	if p == nil {
+		return attrs
+	}
+
+	var redacted []attribute.KeyValue
+	for i, kv := range attrs {
+		if p.Action(string(kv.Key)) == RedactKeep {
+			if redacted != nil {
+				redacted = append(redacted, kv)
+			}
+			continue
+		}
+		if redacted == nil {
+			redacted = append(make([]attribute.KeyValue, 0, len(attrs)), attrs[:i]...)
+		}
+		if kv, ok := p.Redact(kv); ok {
+			redacted = append(redacted, kv)
+		}
+	}
+	if redacted == nil {
+		return attrs
+	}
+
+	return redacted
+}
+
+// hash returns a truncated HMAC-SHA256 of value. Without a key, hashes of
+// small numbers can be reversed by enumerating them.
+func (p *RedactionPolicy) hash(value string) string {
+	mac := hmac.New(sha256.New, p.hashKey)
+	mac.Write([]byte(value))
+
+	return hex.EncodeToString(mac.Sum(nil)[:8])
+}
+
+// magnitudeBucket returns the power of ten interval holding value.
+func magnitudeBucket(value float64) string {
+	if value == 0 || math.IsNaN(value) {
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+
+	abs := math.Abs(value)
+	if math.IsInf(abs, 0) {
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+	lower := math.Pow(10, math.Floor(math.Log10(abs)))
+	low := strconv.FormatFloat(lower, 'g', -1, 64)
+	high := strconv.FormatFloat(lower*10, 'g', -1, 64)
+	if value < 0 {
+		return "(-" + high + ",-" + low + "]"
+	}
+
+	return "[" + low + "," + high + ")"
+}
+
+// view keeps only the metric attributes that have no rule, or a keep rule.
+// Views cannot rewrite values, so hashed and bucketed keys are dropped from
+// metrics.
+func (p *RedactionPolicy) view() metric.View {
+	return metric.NewView(metric.Instrument{Name: "*"}, metric.Stream{
+		AttributeFilter: func(kv attribute.KeyValue) bool {
+			return p.Action(string(kv.Key)) == RedactKeep
+		},
+	})
+}
+
+// redactingSpanProcessor passes ended spans on to the wrapped processor with
+// their attributes and those of their events redacted.
+type redactingSpanProcessor struct {
+	trace.SpanProcessor
+	policy *RedactionPolicy
+}
+
+func (p redactingSpanProcessor) OnEnd(s trace.ReadOnlySpan) {
+	p.SpanProcessor.OnEnd(redactedSpan{ReadOnlySpan: s, policy: p.policy})
+}
+
+// redactedSpan reports the attributes of a span redacted by policy.
+type redactedSpan struct {
+	trace.ReadOnlySpan
+	policy *RedactionPolicy
+}
+
+func (s redactedSpan) Attributes() []attribute.KeyValue {
+	return s.policy.RedactAll(s.ReadOnlySpan.Attributes())
+}
+
+func (s redactedSpan) Events() []trace.Event {
+	events := s.ReadOnlySpan.Events()
+	redacted := make([]trace.Event, len(events))
+	for i, event := range events {
+		event.Attributes = s.policy.RedactAll(event.Attributes)
+		redacted[i] = event
+	}
+
+	return redacted
+}
+
+// AttributeLimits bound the attributes of each span and log record. A
+// negative limit means no limit, and zero keeps the default of the SDK.
+type AttributeLimits struct {
+	Count       int
+	ValueLength int
+}
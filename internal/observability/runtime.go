@@ -0,0 +1,24 @@
+package observability
+
+import (
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/contrib/instrumentation/runtime"
+	otelmetric "go.opentelemetry.io/otel/metric"
+)
+
+// startRuntimeMetrics reports memory, goroutine and scheduler metrics of the
+// Go runtime through provider. Scheduling latency is produced by the readers
+// themselves, see newExporters. The runtime instrumentation is the only
+// source of Go runtime metrics, whichever exporter is selected.
+func startRuntimeMetrics(provider otelmetric.MeterProvider) error {
+	if err := runtime.Start(
+		runtime.WithMeterProvider(provider),
+		runtime.WithMinimumReadMemStatsInterval(time.Second),
+	); err != nil {
+		return fmt.Errorf("failed to start runtime metrics: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,246 @@
+package observability
+
+import (
+	"fmt"
+	"maps"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.32.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+type SamplingConfig struct {
+	// Ratio is the fraction of new traces that are sampled. Spans continuing
+	// a trace follow the sampling decision of their parent.
+	Ratio float64
+	// Routes overrides Ratio, and the decision of a remote parent, for
+	// requests to the given paths.
+	Routes map[string]float64
+	// RateLimit caps the traces this replica starts or joins per second. Zero
+	// disables the limit.
+	RateLimit float64
+	// KeepErrors records the spans that are not sampled, so that those ending
+	// with an error status are exported all the same.
+	KeepErrors bool
+}
+
+func (c *SamplingConfig) validate() error {
+	if c.Ratio < 0 || c.Ratio > 1 {
+		return fmt.Errorf("sampling ratio %v is not between 0 and 1", c.Ratio)
+	}
+	for route, ratio := range c.Routes {
+		if ratio < 0 || ratio > 1 {
+			return fmt.Errorf("sampling ratio %v of route %s is not between 0 and 1", ratio, route)
+		}
+	}
+	if c.RateLimit < 0 {
+		return fmt.Errorf("sampling rate limit %v is negative", c.RateLimit)
+	}
+
+	return nil
+}
+
+// ParseSamplingRoutes parses per-route sampling ratios written as
+// "/ping=0,/history=1".
+func ParseSamplingRoutes(spec string) (map[string]float64, error) {
+	routes := make(map[string]float64)
+	for entry := range strings.SplitSeq(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+
+		route, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid sampling route %q: expected route=ratio", entry)
+		}
+		ratio, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sampling ratio for route %s: %w", route, err)
+		}
+		routes[strings.TrimSpace(route)] = ratio
+	}
+
+	return routes, nil
+}
+
+// Sampler is a parent-based ratio sampler with per-route overrides and a rate
+// limit, whose configuration can be changed while the server runs.
+type Sampler struct {
+	state atomic.Pointer[samplerState]
+}
+
+type samplerState struct {
+	config  SamplingConfig
+	ratio   trace.Sampler
+	routes  map[string]trace.Sampler
+	limiter *rateLimiter
+}
+
+func NewSampler(config SamplingConfig) (*Sampler, error) {
+	s := &Sampler{}
+	if err := s.Update(config); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Config returns a copy of the configuration in effect.
+func (s *Sampler) Config() SamplingConfig {
+	config := s.state.Load().config
+	config.Routes = maps.Clone(config.Routes)
+	if config.Routes == nil {
+		config.Routes = make(map[string]float64)
+	}
+
+	return config
+}
+
+// Update replaces the configuration. Spans started afterwards use it.
+func (s *Sampler) Update(config SamplingConfig) error {
+	if err := config.validate(); err != nil {
+		return err
+	}
+	config.Routes = maps.Clone(config.Routes)
+
+	state := &samplerState{
+		config: config,
+		ratio:  trace.TraceIDRatioBased(config.Ratio),
+		routes: make(map[string]trace.Sampler, len(config.Routes)),
+	}
+	for route, ratio := range config.Routes {
+		state.routes[route] = trace.TraceIDRatioBased(ratio)
+	}
+	if config.RateLimit > 0 {
+		state.limiter = newRateLimiter(config.RateLimit)
+	}
+	s.state.Store(state)
+
+	return nil
+}
+
+func (s *Sampler) ShouldSample(p trace.SamplingParameters) trace.SamplingResult {
+	state := s.state.Load()
+	parent := oteltrace.SpanContextFromContext(p.ParentContext)
+
+	// Spans inside this process follow their parent, recording them only if
+	// the parent is recorded.
+	if parent.IsValid() && !parent.IsRemote() {
+		switch {
+		case parent.IsSampled():
+			return trace.SamplingResult{Decision: trace.RecordAndSample, Tracestate: parent.TraceState()}
+		case oteltrace.SpanFromContext(p.ParentContext).IsRecording():
+			return trace.SamplingResult{Decision: trace.RecordOnly, Tracestate: parent.TraceState()}
+		default:
+			return trace.SamplingResult{Decision: trace.Drop, Tracestate: parent.TraceState()}
+		}
+	}
+
+	var sampled bool
+	path := requestPath(p)
+	if ratio, ok := state.config.Routes[path]; ok {
+		// A route that is never sampled is not recorded either, errors
+		// included.
+		if ratio == 0 {
+			return trace.SamplingResult{Decision: trace.Drop, Tracestate: parent.TraceState()}
+		}
+		sampled = state.routes[path].ShouldSample(p).Decision == trace.RecordAndSample
+	} else if parent.IsValid() {
+		sampled = parent.IsSampled()
+	} else {
+		sampled = state.ratio.ShouldSample(p).Decision == trace.RecordAndSample
+	}
+
+	if sampled && state.limiter != nil && !state.limiter.Allow() {
+		sampled = false
+	}
+
+	switch {
+	case sampled:
+		return trace.SamplingResult{Decision: trace.RecordAndSample, Tracestate: parent.TraceState()}
+	case state.config.KeepErrors:
+		return trace.SamplingResult{Decision: trace.RecordOnly, Tracestate: parent.TraceState()}
+	default:
+		return trace.SamplingResult{Decision: trace.Drop, Tracestate: parent.TraceState()}
+	}
+}
+
+func (s *Sampler) Description() string {
+	config := s.Config()
+	return fmt.Sprintf("CalculatorSampler{ratio=%g,routes=%v,rateLimit=%g,keepErrors=%t}",
+		config.Ratio, config.Routes, config.RateLimit, config.KeepErrors)
+}
+
+// requestPath returns the URL path of an HTTP server span.
+func requestPath(p trace.SamplingParameters) string {
+	for _, attr := range p.Attributes {
+		if attr.Key == semconv.URLPathKey {
+			return attr.Value.AsString()
+		}
+	}
+
+	return ""
+}
+
+// rateLimiter is a token bucket refilled at rate tokens per second, holding at
+// most one second worth of tokens.
+type rateLimiter struct {
+	rate float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newRateLimiter(rate float64) *rateLimiter {
+	return &rateLimiter{rate: rate, tokens: max(rate, 1), last: time.Now()}
+}
+
+func (l *rateLimiter) Allow() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	l.tokens = min(l.tokens+now.Sub(l.last).Seconds()*l.rate, max(l.rate, 1))
+	l.last = now
+	if l.tokens < 1 {
+		return false
+	}
+	l.tokens--
+
+	return true
+}
+
+// errorSpanProcessor passes sampled spans on to the wrapped processor, along
+// with the spans that were only recorded and ended with an error status.
+// Those are exported as if they had been sampled, without the rest of their
+// trace.
+type errorSpanProcessor struct {
+	trace.SpanProcessor
+}
+
+func (p errorSpanProcessor) OnEnd(s trace.ReadOnlySpan) {
+	switch {
+	case s.SpanContext().IsSampled():
+		p.SpanProcessor.OnEnd(s)
+	case s.Status().Code == codes.Error:
+		p.SpanProcessor.OnEnd(sampledSpan{s})
+	}
+}
+
+// sampledSpan reports a recorded span as sampled.
+type sampledSpan struct {
+	trace.ReadOnlySpan
+}
+
+func (s sampledSpan) SpanContext() oteltrace.SpanContext {
+	sc := s.ReadOnlySpan.SpanContext()
+	return sc.WithTraceFlags(sc.TraceFlags().WithSampled(true))
+}
@@ -0,0 +1,190 @@
+package observability
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// spanSamples is how many recent, slowest and failed spans are kept per
+	// span name.
+	spanSamples = 10
+	// maxSpanNames bounds the memory of the store. Spans with names seen
+	// after the limit is reached are not kept.
+	maxSpanNames = 1000
+)
+
+// latencyBounds are the upper bounds of the latency buckets of each span
+// name. The last bucket has no upper bound.
+var latencyBounds = []time.Duration{
+	10 * time.Microsecond,
+	100 * time.Microsecond,
+	time.Millisecond,
+	10 * time.Millisecond,
+	100 * time.Millisecond,
+	time.Second,
+	10 * time.Second,
+}
+
+// spanSample is a finished span kept for display.
+type spanSample struct {
+	TraceID    oteltrace.TraceID
+	SpanID     oteltrace.SpanID
+	Sampled    bool
+	Start      time.Time
+	Duration   time.Duration
+	Status     codes.Code
+	Message    string
+	Attributes []attribute.KeyValue
+}
+
+// spanSummary aggregates the finished spans of one name.
+type spanSummary struct {
+	Name     string
+	Kind     oteltrace.SpanKind
+	Count    int64
+	Errors   int64
+	Total    time.Duration
+	Max      time.Duration
+	Latency  []int64
+	Recent   []spanSample
+	Slowest  []spanSample
+	Failures []spanSample
+}
+
+func (s spanSummary) Mean() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+
+	return s.Total / time.Duration(s.Count)
+}
+
+// spanStore is a span processor that keeps, per span name, latency buckets
+// and samples of recent, slow and failed spans, for the debug pages of a
+// single replica. It sees every recorded span, sampled or not.
+type spanStore struct {
+	mu    sync.Mutex
+	names map[string]*spanSummary
+}
+
+func newSpanStore() *spanStore {
+	return &spanStore{names: make(map[string]*spanSummary)}
+}
+
+func (*spanStore) OnStart(context.Context, trace.ReadWriteSpan) {}
+
+func (st *spanStore) OnEnd(s trace.ReadOnlySpan) {
+	sample := spanSample{
+		TraceID:    s.SpanContext().TraceID(),
+		SpanID:     s.SpanContext().SpanID(),
+		Sampled:    s.SpanContext().IsSampled(),
+		Start:      s.StartTime(),
+		Duration:   s.EndTime().Sub(s.StartTime()),
+		Status:     s.Status().Code,
+		Message:    s.Status().Description,
+		Attributes: s.Attributes(),
+	}
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	summary, ok := st.names[s.Name()]
+	if !ok {
+		if len(st.names) >= maxSpanNames {
+			return
+		}
+		summary = &spanSummary{
+			Name:    s.Name(),
+			Kind:    s.SpanKind(),
+			Latency: make([]int64, len(latencyBounds)+1),
+		}
+		st.names[s.Name()] = summary
+	}
+
+	summary.Count++
+	summary.Total += sample.Duration
+	summary.Max = max(summary.Max, sample.Duration)
+	bucket, _ := slices.BinarySearch(latencyBounds, sample.Duration)
+	summary.Latency[bucket]++
+
+	summary.Recent = appendRing(summary.Recent, sample)
+	if sample.Status == codes.Error {
+		summary.Errors++
+		summary.Failures = appendRing(summary.Failures, sample)
+	}
+	if len(summary.Slowest) < spanSamples || sample.Duration > summary.Slowest[len(summary.Slowest)-1].Duration {
+		i, _ := slices.BinarySearchFunc(summary.Slowest, sample, func(a, b spanSample) int {
+			return cmp.Compare(b.Duration, a.Duration)
+		})
+		summary.Slowest = slices.Insert(summary.Slowest, i, sample)
+		if len(summary.Slowest) > spanSamples {
+			summary.Slowest = summary.Slowest[:spanSamples]
+		}
+	}
+}
+
+func (*spanStore) Shutdown(context.Context) error { return nil }
+
+func (*spanStore) ForceFlush(context.Context) error { return nil }
+
+// summaries returns a copy of the summaries of kinds, or of every span
+// name when kinds is empty, sorted by name.
+func (st *spanStore) summaries(kinds ...oteltrace.SpanKind) []spanSummary {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	summaries := make([]spanSummary, 0, len(st.names))
+	for _, summary := range st.names {
+		if len(kinds) > 0 && !slices.Contains(kinds, summary.Kind) {
+			continue
+		}
+		summaries = append(summaries, summary.clone())
+	}
+	slices.SortFunc(summaries, func(a, b spanSummary) int {
+		return cmp.Compare(a.Name, b.Name)
+	})
+
+	return summaries
+}
+
+// summary returns a copy of the summary of name.
+func (st *spanStore) summary(name string) (spanSummary, bool) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	summary, ok := st.names[name]
+	if !ok {
+		return spanSummary{}, false
+	}
+
+	return summary.clone(), true
+}
+
+func (s *spanSummary) clone() spanSummary {
+	clone := *s
+	clone.Latency = slices.Clone(s.Latency)
+	clone.Recent = slices.Clone(s.Recent)
+	clone.Slowest = slices.Clone(s.Slowest)
+	clone.Failures = slices.Clone(s.Failures)
+
+	return clone
+}
+
+// appendRing appends sample, dropping the oldest of the samples beyond
+// spanSamples.
+func appendRing(samples []spanSample, sample spanSample) []spanSample {
+	if len(samples) == spanSamples {
+		samples = slices.Delete(samples, 0, 1)
+	}
+
+	return append(samples, sample)
+}
@@ -0,0 +1,153 @@
+package observability
+
+import (
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// DebugConfig configures the /debug/tracez and /debug/rpcz pages.
+type DebugConfig struct {
+	// Enabled serves the pages on the admin endpoint.
+	Enabled bool
+	// JaegerURL is the base URL of the Jaeger UI that traces are linked to.
+	// Empty leaves trace IDs unlinked.
+	JaegerURL string
+}
+
+// debugPages renders the spans kept by a spanStore.
+type debugPages struct {
+	store     *spanStore
+	jaegerURL string
+}
+
+// register serves the pages on mux.
+func (p *debugPages) register(mux *http.ServeMux) {
+	mux.HandleFunc("GET /debug/tracez", p.tracez)
+	mux.HandleFunc("GET /debug/rpcz", p.rpcz)
+}
+
+// tracez lists the latency buckets and error counts of every span name, or
+// the recent, slowest and failed spans of the one named in the query.
+func (p *debugPages) tracez(w http.ResponseWriter, r *http.Request) {
+	name := r.URL.Query().Get("name")
+	if name == "" {
+		p.render(w, r, "tracez", map[string]any{
+			"Bounds":    latencyLabels(),
+			"Summaries": p.store.summaries(),
+		})
+		return
+	}
+
+	summary, ok := p.store.summary(name)
+	if !ok {
+		http.Error(w, fmt.Sprintf("no spans named %q", name), http.StatusNotFound)
+		return
+	}
+	p.render(w, r, "spans", map[string]any{
+		"Summary":   summary,
+		"JaegerURL": p.jaegerURL,
+	})
+}
+
+// rpcz lists the counts, errors and latencies of the HTTP requests served
+// and the cache and database calls made by the replica, from their server
+// and client spans.
+func (p *debugPages) rpcz(w http.ResponseWriter, r *http.Request) {
+	p.render(w, r, "rpcz", map[string]any{
+		"Bounds":    latencyLabels(),
+		"Summaries": p.store.summaries(oteltrace.SpanKindServer, oteltrace.SpanKindClient),
+	})
+}
+
+func (p *debugPages) render(w http.ResponseWriter, r *http.Request, name string, data any) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := debugTemplates.ExecuteTemplate(w, name, data); err != nil {
+		slog.ErrorContext(r.Context(), "failed to render debug page", "page", name, "error", err)
+	}
+}
+
+func latencyLabels() []string {
+	labels := make([]string, 0, len(latencyBounds)+1)
+	for _, bound := range latencyBounds {
+		labels = append(labels, "≤"+bound.String())
+	}
+
+	return append(labels, ">"+latencyBounds[len(latencyBounds)-1].String())
+}
+
+var debugTemplates = template.Must(template.New("debug").Funcs(template.FuncMap{
+	"duration": func(d time.Duration) string { return d.Round(time.Microsecond).String() },
+	"time":     func(t time.Time) string { return t.Format("15:04:05.000") },
+	"jaeger": func(base string, traceID oteltrace.TraceID) string {
+		return strings.TrimRight(base, "/") + "/trace/" + traceID.String()
+	},
+	"samples": func(samples []spanSample, jaegerURL string) map[string]any {
+		return map[string]any{"Samples": samples, "JaegerURL": jaegerURL}
+	},
+	"percent": func(part, total int64) string {
+		if total == 0 {
+			return "0%"
+		}
+		return fmt.Sprintf("%.1f%%", 100*float64(part)/float64(total))
+	},
+}).Parse(`
+{{define "header"}}<!DOCTYPE html>
+<html><head><title>{{.}}</title><style>
+body { font-family: sans-serif; font-size: 14px; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { border: 1px solid #ccc; padding: 4px 8px; text-align: right; }
+th:first-child, td:first-child, td.text { text-align: left; }
+.error { color: #b00; }
+</style></head><body>
+<p><a href="/debug/tracez">tracez</a> | <a href="/debug/rpcz">rpcz</a></p>
+<h1>{{.}}</h1>{{end}}
+
+{{define "footer"}}</body></html>{{end}}
+
+{{define "tracez"}}{{template "header" "Spans"}}
+<table>
+<tr><th>Span name</th><th>Count</th><th>Errors</th>{{range .Bounds}}<th>{{.}}</th>{{end}}</tr>
+{{range .Summaries}}<tr>
+<td><a href="?name={{.Name}}">{{.Name}}</a></td><td>{{.Count}}</td>
+<td{{if .Errors}} class="error"{{end}}>{{.Errors}}</td>
+{{range .Latency}}<td>{{.}}</td>{{end}}
+</tr>{{end}}
+</table>
+{{template "footer"}}{{end}}
+
+{{define "samples"}}<table>
+<tr><th>Start</th><th>Duration</th><th>Trace</th><th>Span</th><th>Status</th><th>Attributes</th></tr>
+{{range .Samples}}<tr>
+<td>{{time .Start}}</td><td>{{duration .Duration}}</td>
+<td class="text">{{if and $.JaegerURL .Sampled}}<a href="{{jaeger $.JaegerURL .TraceID}}">{{.TraceID}}</a>{{else}}{{.TraceID}}{{if not .Sampled}} (not sampled){{end}}{{end}}</td>
+<td class="text">{{.SpanID}}</td>
+<td class="text{{if eq .Status.String "Error"}} error{{end}}">{{.Status}}{{with .Message}}: {{.}}{{end}}</td>
+<td class="text">{{range .Attributes}}{{.Key}}={{.Value.Emit}} {{end}}</td>
+</tr>{{end}}
+</table>{{end}}
+
+{{define "spans"}}{{template "header" .Summary.Name}}
+<p>{{.Summary.Count}} spans, {{.Summary.Errors}} errors, mean {{duration .Summary.Mean}}, max {{duration .Summary.Max}}</p>
+<h2>Slowest</h2>{{template "samples" (samples .Summary.Slowest .JaegerURL)}}
+<h2>Recent</h2>{{template "samples" (samples .Summary.Recent .JaegerURL)}}
+<h2>Errors</h2>{{template "samples" (samples .Summary.Failures .JaegerURL)}}
+{{template "footer"}}{{end}}
+
+{{define "rpcz"}}{{template "header" "Calls"}}
+<table>
+<tr><th>Call</th><th>Kind</th><th>Count</th><th>Errors</th><th>Error rate</th><th>Mean</th><th>Max</th>{{range .Bounds}}<th>{{.}}</th>{{end}}</tr>
+{{range .Summaries}}<tr>
+<td><a href="/debug/tracez?name={{.Name}}">{{.Name}}</a></td><td class="text">{{.Kind}}</td><td>{{.Count}}</td>
+<td{{if .Errors}} class="error"{{end}}>{{.Errors}}</td><td>{{percent .Errors .Count}}</td>
+<td>{{duration .Mean}}</td><td>{{duration .Max}}</td>
+{{range .Latency}}<td>{{.}}</td>{{end}}
+</tr>{{end}}
+</table>
+{{template "footer"}}{{end}}
+`))
@@ -0,0 +1,100 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// invalidateBatchSize caps the number of keys removed by a single DEL.
+const invalidateBatchSize = 500
+
+// CacheEntry is a cached value together with its remaining lifetime.
+type CacheEntry struct {
+	Key   string
+	Value int
+	TTL   time.Duration
+}
+
+// InspectCache returns the cached value stored under key.
+func (s *Service) InspectCache(ctx context.Context, key string) (*CacheEntry, error) {
+	value, err := s.cache.Get(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cache entry: %w", err)
+	}
+
+	ttl, err := s.cache.TTL(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cache entry TTL: %w", err)
+	}
+
+	return &CacheEntry{Key: key, Value: value, TTL: ttl}, nil
+}
+
+// DeleteCacheKey removes key from the cache and reports whether it existed.
+func (s *Service) DeleteCacheKey(ctx context.Context, key string) (bool, error) {
+	deleted, err := s.cache.Delete(ctx, key)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete cache entry: %w", err)
+	}
+
+	s.logger.InfoContext(ctx, "deleted cache entry", "key", key, "existed", deleted > 0)
+
+	return deleted > 0, nil
+}
+
+// InvalidateCache removes every key matching the glob-style pattern and
+// returns how many were deleted.
+func (s *Service) InvalidateCache(ctx context.Context, pattern string) (int64, error) {
+	keys, err := s.cache.Scan(ctx, pattern)
+	if err != nil {
+		return 0, fmt.Errorf("failed to scan cache: %w", err)
+	}
+
+	var deleted int64
+	for start := 0; start < len(keys); start += invalidateBatchSize {
+		end := min(start+invalidateBatchSize, len(keys))
+		n, err := s.cache.Delete(ctx, keys[start:end]...)
+		if err != nil {
+			return deleted, fmt.Errorf("failed to delete cache entries: %w", err)
+		}
+		deleted += n
+	}
+
+	trace.SpanFromContext(ctx).AddEvent("Cache invalidated", trace.WithAttributes(
+		attribute.String("pattern", pattern),
+		attribute.Int64("deleted", deleted),
+	))
+	s.logger.InfoContext(ctx, "invalidated cache entries", "pattern", pattern, "deleted", deleted)
+
+	return deleted, nil
+}
+
+// WarmCache loads the results of the last n history records into the cache
+// and returns how many entries were written.
+func (s *Service) WarmCache(ctx context.Context, n int) (int, error) {
+	history, err := s.storage.GetHistory(ctx, n)
+	if err != nil {
+		return 0, fmt.Errorf("failed to get history: %w", err)
+	}
+
+	warmed := 0
+	for _, record := range history {
+		if !s.policy.Enabled(record.Operation) {
+			continue
+		}
+
+		key := createCacheKey(record.Input1, record.Input2, record.Operation)
+		if err := s.cache.SetWithTTL(ctx, key, record.Result, s.policy.TTL(record.Operation)); err != nil {
+			return warmed, fmt.Errorf("failed to set cache entry %s: %w", key, err)
+		}
+		warmed++
+	}
+
+	s.logger.InfoContext(ctx, "warmed cache from history", "requested", n, "warmed", warmed)
+
+	return warmed, nil
+}
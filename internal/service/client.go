@@ -0,0 +1,18 @@
+package service
+
+import "context"
+
+type clientIDKey struct{}
+
+// WithClientID returns a copy of ctx carrying the identity of the client the
+// request is served for. It is recorded with the request's history.
+func WithClientID(ctx context.Context, clientID string) context.Context {
+	return context.WithValue(ctx, clientIDKey{}, clientID)
+}
+
+// ClientID returns the client identity stored by WithClientID, or an empty
+// string.
+func ClientID(ctx context.Context) string {
+	clientID, _ := ctx.Value(clientIDKey{}).(string)
+	return clientID
+}
@@ -11,3 +11,16 @@ const (
 	OperandDivide = "divide"
 	// OperandPing represents the ping operation.
 )
+
+// commutativeOperands lists the operations whose result does not depend on the
+// order of their operands.
+var commutativeOperands = map[string]bool{
+	OperandAdd:      true,
+	OperandMultiply: true,
+}
+
+// IsCommutative reports whether operation yields the same result for (a, b)
+// and (b, a).
+func IsCommutative(operation string) bool {
+	return commutativeOperands[operation]
+}
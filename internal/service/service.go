@@ -2,217 +2,273 @@ package service
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"time"
 
 	"calculator-otel/internal/cache"
 	"calculator-otel/internal/logger"
+	"calculator-otel/internal/metrics"
 	"calculator-otel/internal/storage"
 
+	"github.com/google/uuid"
 	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.32.0"
 	"go.opentelemetry.io/otel/trace"
 )
 
+// ErrDivisionByZero is returned by Divide when the divisor is zero.
+var ErrDivisionByZero = errors.New("division by zero")
+
+const (
+	// CacheKeyNamespace prefixes every calculation result stored in the cache.
+	CacheKeyNamespace = "calc"
+	// CacheKeyVersion is bumped whenever the key layout or the cached value
+	// format changes, so a whole generation of keys can be abandoned without
+	// flushing the cache.
+	CacheKeyVersion = "v2"
+)
+
 type Service struct {
 	logger  logger.Logger
 	cache   cache.Cache[int]
+	policy  *cache.Policy
 	storage storage.Storage
+	// instanceID is recorded with every history record this replica writes.
+	instanceID string
+	metrics    *metrics.Metrics
+	tracer     trace.Tracer
 }
 
-func New(logger logger.Logger, cache cache.Cache[int], storage storage.Storage) *Service {
+func New(logger logger.Logger, cache cache.Cache[int], policy *cache.Policy, storage storage.Storage, instanceID string, metrics *metrics.Metrics, tracer trace.Tracer) *Service {
 	return &Service{
-		logger:  logger,
-		cache:   cache,
-		storage: storage,
+		logger:     logger,
+		cache:      cache,
+		policy:     policy,
+		storage:    storage,
+		instanceID: instanceID,
+		metrics:    metrics,
+		tracer:     tracer,
 	}
 }
 
 func (s *Service) Add(ctx context.Context, a, b int) int {
-	trace.SpanFromContext(ctx).AddEvent("Adding numbers", trace.WithAttributes(
-		attribute.Float64("a", float64(a)),
-		attribute.Float64("b", float64(b)),
-		attribute.String("operation", "add"),
-	))
+	ctx, span := s.startCalculation(ctx, "service.Add", OperandAdd, a, b)
+	defer span.End()
 
-	result, err := s.cache.Get(ctx, createCacheKey(a, b, "add"))
-	if err == nil {
-		trace.SpanFromContext(ctx).AddEvent("Cache hit", trace.WithAttributes(
-			attribute.String("key", createCacheKey(a, b, "add")),
-			attribute.String("operation", "add"),
-		))
-		err = s.writeHistory(ctx, a, b, result, "add")
-		if err != nil {
-			s.logger.ErrorContext(ctx, "failed to write history for add operation from cache", "error", err)
-		}
+	return s.calculate(ctx, a, b, OperandAdd, func() int { return a + b })
+}
 
-		return result
-	}
+func (s *Service) Subtract(ctx context.Context, a, b int) int {
+	ctx, span := s.startCalculation(ctx, "service.Subtract", OperandSubtract, a, b)
+	defer span.End()
 
-	result = a + b
+	return s.calculate(ctx, a, b, OperandSubtract, func() int { return a - b })
+}
 
-	trace.SpanFromContext(ctx).AddEvent("Addition result", trace.WithAttributes(
-		attribute.Float64("result", float64(result)),
-		attribute.String("operation", "add"),
-	))
+func (s *Service) Multiply(ctx context.Context, a, b int) int {
+	ctx, span := s.startCalculation(ctx, "service.Multiply", OperandMultiply, a, b)
+	defer span.End()
 
-	err = s.cache.Set(ctx, createCacheKey(a, b, "add"), result)
-	if err != nil {
-		s.logger.ErrorContext(ctx, "failed to set cache value", "error", err, "key", createCacheKey(a, b, "add"))
-	}
+	return s.calculate(ctx, a, b, OperandMultiply, func() int { return a * b })
+}
 
-	err = s.writeHistory(ctx, a, b, result, "add")
-	if err != nil {
-		s.logger.ErrorContext(ctx, "failed to write history for add operation", "error", err)
+func (s *Service) Divide(ctx context.Context, a, b int) (int, error) {
+	ctx, span := s.startCalculation(ctx, "service.Divide", OperandDivide, a, b)
+	defer span.End()
+
+	if b == 0 {
+		recordError(span, ErrDivisionByZero)
+		return 0, ErrDivisionByZero
 	}
 
-	return result
+	return s.calculate(ctx, a, b, OperandDivide, func() int { return a / b }), nil
 }
 
-func (s *Service) Subtract(ctx context.Context, a, b int) int {
-	trace.SpanFromContext(ctx).AddEvent("Subtracting numbers", trace.WithAttributes(
-		attribute.Float64("a", float64(a)),
-		attribute.Float64("b", float64(b)),
-		attribute.String("operation", "subtract"),
+func (s *Service) startCalculation(ctx context.Context, name, operation string, a, b int) (context.Context, trace.Span) {
+	return s.tracer.Start(ctx, name, trace.WithAttributes(
+		attribute.String("calculator.operation", operation),
+		attribute.Int("calculator.input1", a),
+		attribute.Int("calculator.input2", b),
 	))
+}
 
-	result, err := s.cache.Get(ctx, createCacheKey(a, b, "subtract"))
-	if err == nil {
-		trace.SpanFromContext(ctx).AddEvent("Cache hit", trace.WithAttributes(
-			attribute.String("key", createCacheKey(a, b, "subtract")),
-			attribute.String("operation", "subtract"),
-		))
-		err = s.writeHistory(ctx, a, b, result, "subtract")
-		if err != nil {
-			s.logger.ErrorContext(ctx, "failed to write history for subtract operation from cache", "error", err)
+// calculate serves a calculation from the cache when possible, otherwise
+// computes it and caches the result as the policy allows. Every calculation is
+// written to the history.
+func (s *Service) calculate(ctx context.Context, a, b int, operation string, compute func() int) int {
+	span := trace.SpanFromContext(ctx)
+	key := createCacheKey(a, b, operation)
+	s.metrics.RecordOperands(ctx, operation, a, b)
+
+	if s.policy.Enabled(operation) {
+		result, err := s.cacheGet(ctx, key)
+		s.metrics.RecordCacheLookup(ctx, operation, cacheLookupResult(err))
+		if err == nil {
+			span.AddEvent("Cache hit", trace.WithAttributes(attribute.String("cache.key", key)))
+			span.SetAttributes(attribute.Int("calculator.result", result))
+
+			err = s.writeHistory(ctx, &storage.HistoryRecord{
+				Input1:    a,
+				Input2:    b,
+				Result:    result,
+				Operation: operation,
+				CacheHit:  true,
+			})
+			if err != nil {
+				s.logger.ErrorContext(ctx, "failed to write history from cache", "error", err, "calculator.operation", operation)
+			}
+
+			return result
 		}
-
-		return result
 	}
 
-	result = a - b
+	start := time.Now()
+	result := compute()
+	computeCost := time.Since(start)
+	s.metrics.RecordCompute(ctx, operation, computeCost)
 
-	trace.SpanFromContext(ctx).AddEvent("Subtraction result", trace.WithAttributes(
-		attribute.Float64("result", float64(result)),
-		attribute.String("operation", "subtract"),
-	))
+	span.SetAttributes(attribute.Int("calculator.result", result))
 
-	err = s.cache.Set(ctx, createCacheKey(a, b, "subtract"), result)
-	if err != nil {
-		s.logger.ErrorContext(ctx, "failed to set cache value", "error", err, "key", createCacheKey(a, b, "subtract"))
+	if s.policy.ShouldStore(operation, computeCost) {
+		err := s.cacheSet(ctx, key, result, s.policy.TTL(operation))
+		if err != nil && !errors.Is(err, cache.ErrCircuitOpen) {
+			s.logger.ErrorContext(ctx, "failed to set cache value", "error", err, "key", key)
+		}
 	}
 
-	err = s.writeHistory(ctx, a, b, result, "subtract")
+	err := s.writeHistory(ctx, &storage.HistoryRecord{
+		Input1:          a,
+		Input2:          b,
+		Result:          result,
+		Operation:       operation,
+		ComputeDuration: computeCost,
+	})
 	if err != nil {
-		s.logger.ErrorContext(ctx, "failed to write history for subtract operation", "error", err)
+		s.logger.ErrorContext(ctx, "failed to write history", "error", err, "calculator.operation", operation)
 	}
 
 	return result
 }
 
-func (s *Service) Multiply(ctx context.Context, a, b int) int {
-	trace.SpanFromContext(ctx).AddEvent("Multiplying numbers", trace.WithAttributes(
-		attribute.Float64("a", float64(a)),
-		attribute.Float64("b", float64(b)),
-		attribute.String("operation", "multiply"),
+// cacheGet looks key up in a cache.get span. A miss is a normal outcome and
+// does not mark the span as failed.
+func (s *Service) cacheGet(ctx context.Context, key string) (int, error) {
+	ctx, span := s.tracer.Start(ctx, "cache.get", trace.WithAttributes(
+		dbSystemValkey,
+		semconv.DBOperationName("GET"),
+		attribute.String("cache.key", key),
 	))
-
-	result, err := s.cache.Get(ctx, createCacheKey(a, b, "multiply"))
-	if err == nil {
-		trace.SpanFromContext(ctx).AddEvent("Cache hit", trace.WithAttributes(
-			attribute.String("key", createCacheKey(a, b, "multiply")),
-			attribute.String("operation", "multiply"),
-		))
-
-		err = s.writeHistory(ctx, a, b, result, "multiply")
-		if err != nil {
-			s.logger.ErrorContext(ctx, "failed to write history for multiply operation from cache", "error", err)
-		}
-
-		return result
+	defer span.End()
+
+	result, err := s.cache.Get(ctx, key)
+	switch {
+	case err == nil:
+		span.SetAttributes(attribute.Bool("cache.hit", true))
+	case errors.Is(err, cache.ErrKeyNotFound):
+		span.SetAttributes(attribute.Bool("cache.hit", false))
+	default:
+		recordError(span, err)
 	}
 
-	result = a * b
+	return result, err
+}
 
-	trace.SpanFromContext(ctx).AddEvent("Multiplication result", trace.WithAttributes(
-		attribute.Float64("result", float64(result)),
-		attribute.String("operation", "multiply"),
+func (s *Service) cacheSet(ctx context.Context, key string, value int, ttl time.Duration) error {
+	ctx, span := s.tracer.Start(ctx, "cache.set", trace.WithAttributes(
+		dbSystemValkey,
+		semconv.DBOperationName("SET"),
+		attribute.String("cache.key", key),
+		attribute.Float64("cache.ttl", ttl.Seconds()),
 	))
+	defer span.End()
 
-	err = s.cache.Set(ctx, createCacheKey(a, b, "multiply"), result)
-	if err != nil {
-		s.logger.ErrorContext(ctx, "failed to set cache value", "error", err, "key", createCacheKey(a, b, "multiply"))
-	}
-
-	err = s.writeHistory(ctx, a, b, result, "multiply")
-	if err != nil {
-		s.logger.ErrorContext(ctx, "failed to write history for multiply operation", "error", err)
-	}
+	err := s.cache.SetWithTTL(ctx, key, value, ttl)
+	recordError(span, err)
 
-	return result
+	return err
 }
 
-func (s *Service) Divide(ctx context.Context, a, b int) (int, error) {
-	trace.SpanFromContext(ctx).AddEvent("Dividing numbers", trace.WithAttributes(
-		attribute.Float64("a", float64(a)),
-		attribute.Float64("b", float64(b)),
-		attribute.String("operation", "divide"),
-	))
+// cacheLookupResult classifies the error returned by a cache lookup.
+func cacheLookupResult(err error) string {
+	switch {
+	case err == nil:
+		return metrics.CacheHit
+	case errors.Is(err, cache.ErrKeyNotFound):
+		return metrics.CacheMiss
+	default:
+		return metrics.CacheError
+	}
+}
 
-	result, err := s.cache.Get(ctx, createCacheKey(a, b, "divide"))
-	if err == nil {
-		trace.SpanFromContext(ctx).AddEvent("Cache hit", trace.WithAttributes(
-			attribute.String("key", createCacheKey(a, b, "divide")),
-			attribute.String("operation", "divide"),
-		))
+// createCacheKey builds the cache key for a calculation. Operands of
+// commutative operations are put in ascending order so that 3+5 and 5+3 share
+// a single entry.
+func createCacheKey(a, b int, operation string) string {
+	if IsCommutative(operation) && a > b {
+		a, b = b, a
+	}
 
-		err = s.writeHistory(ctx, a, b, result, "divide")
-		if err != nil {
-			s.logger.ErrorContext(ctx, "failed to write history for divide operation from cache", "error", err)
-		}
+	return fmt.Sprintf("%s:%s:%s:%d:%d", CacheKeyNamespace, CacheKeyVersion, operation, a, b)
+}
 
-		return result, nil
+// writeHistory stores record after filling in its identity and the request
+// metadata carried by ctx.
+func (s *Service) writeHistory(ctx context.Context, record *storage.HistoryRecord) error {
+	record.UUID = uuid.NewString()
+	record.CreatedAt = time.Now().UTC()
+	record.InstanceID = s.instanceID
+	record.ClientID = ClientID(ctx)
+	if spanContext := trace.SpanContextFromContext(ctx); spanContext.IsValid() {
+		record.TraceID = spanContext.TraceID().String()
+		record.SpanID = spanContext.SpanID().String()
 	}
 
-	result = a / b
-
-	trace.SpanFromContext(ctx).AddEvent("Division result", trace.WithAttributes(
-		attribute.Float64("result", float64(result)),
-		attribute.String("operation", "divide"),
+	ctx, span := s.tracer.Start(ctx, "history.write", trace.WithAttributes(
+		attribute.String("calculator.operation", record.Operation),
+		attribute.String("history.record.uuid", record.UUID),
 	))
+	defer span.End()
 
-	err = s.cache.Set(ctx, createCacheKey(a, b, "divide"), result)
-	if err != nil {
-		s.logger.ErrorContext(ctx, "failed to set cache value", "error", err, "key", createCacheKey(a, b, "divide"))
-	}
-
-	err = s.writeHistory(ctx, a, b, result, "divide")
-	if err != nil {
-		s.logger.ErrorContext(ctx, "failed to write history for divide operation", "error", err)
+	if err := s.storage.Write(ctx, record); err != nil {
+		recordError(span, err)
+		s.metrics.RecordHistoryFailure(ctx, record.Operation)
+		s.logger.ErrorContext(ctx, "failed to write history", "error", err, "calculator.input1", record.Input1, "calculator.input2", record.Input2, "calculator.result", record.Result, "calculator.operation", record.Operation)
+		return fmt.Errorf("failed to write history: %w", err)
 	}
-
-	return result, nil
+	return nil
 }
 
-func createCacheKey(a, b int, operation string) string {
-	return fmt.Sprintf("%d:%d:%s", a, b, operation)
-}
+func (s *Service) GetHistory(ctx context.Context, limit int) ([]*storage.HistoryRecord, error) {
+	ctx, span := s.tracer.Start(ctx, "history.read", trace.WithAttributes(
+		attribute.Int("history.limit", limit),
+	))
+	defer span.End()
 
-func (s *Service) writeHistory(ctx context.Context, input1, input2, result int, operation string) error {
-	if err := s.storage.Write(ctx, input1, input2, result, operation); err != nil {
-		s.logger.ErrorContext(ctx, "failed to write history", "error", err, "input1", input1, "input2", input2, "result", result, "operation", operation)
-		return fmt.Errorf("failed to write history: %w", err)
+	history, err := s.storage.GetHistory(ctx, limit)
+	if err != nil {
+		recordError(span, err)
+		s.logger.ErrorContext(ctx, "failed to get history", "error", err)
+		return nil, fmt.Errorf("failed to get history: %w", err)
 	}
-	return nil
+	span.SetAttributes(semconv.DBResponseReturnedRows(len(history)))
+
+	return history, nil
 }
 
-func (s *Service) GetHistory(ctx context.Context) ([]*storage.HistoryRecord, error) {
-	trace.SpanFromContext(ctx).AddEvent("Retrieving history", trace.WithAttributes(
-		attribute.String("operation", "get_history"),
+func (s *Service) GetHistoryByTraceID(ctx context.Context, traceID string) ([]*storage.HistoryRecord, error) {
+	ctx, span := s.tracer.Start(ctx, "history.read", trace.WithAttributes(
+		attribute.String("history.trace_id", traceID),
 	))
+	defer span.End()
 
-	history, err := s.storage.GetHistory(ctx)
+	history, err := s.storage.GetHistoryByTraceID(ctx, traceID)
 	if err != nil {
-		s.logger.ErrorContext(ctx, "failed to get history", "error", err)
+		recordError(span, err)
+		s.logger.ErrorContext(ctx, "failed to get history", "error", err, "trace_id", traceID)
 		return nil, fmt.Errorf("failed to get history: %w", err)
 	}
+	span.SetAttributes(semconv.DBResponseReturnedRows(len(history)))
+
 	return history, nil
 }
@@ -0,0 +1,43 @@
+package service
+
+import (
+	"context"
+	"errors"
+
+	"calculator-otel/internal/cache"
+
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.32.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// dbSystemValkey identifies the cache on cache spans. Valkey has no value of
+// its own in the semantic conventions yet.
+var dbSystemValkey = semconv.DBSystemNameKey.String("valkey")
+
+// recordError marks span as failed with err, if there is one.
+func recordError(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+	span.SetAttributes(semconv.ErrorTypeKey.String(errorType(err)))
+}
+
+// errorType classifies err into a low-cardinality error.type value.
+func errorType(err error) string {
+	switch {
+	case errors.Is(err, ErrDivisionByZero):
+		return "division_by_zero"
+	case errors.Is(err, cache.ErrCircuitOpen):
+		return "circuit_open"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	default:
+		return semconv.ErrorTypeOther.Value.AsString()
+	}
+}
@@ -0,0 +1,108 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// maxBatchRows bounds the rows of one multi-row INSERT, keeping the number of
+// bind parameters well below the PostgreSQL and SQLite limits.
+const maxBatchRows = 1000
+
+// insertColumns are the calculator_history columns written for a record, in
+// the order of recordArgs.
+var insertColumns = []string{
+	"record_uuid", "input1", "input2", "result", "operation", "created_at",
+	"trace_id", "span_id", "instance_id", "client_id", "cache_hit", "compute_duration_ns",
+}
+
+// selectHistory selects the columns read by scanHistory.
+const selectHistory = `SELECT id, record_uuid, input1, input2, result, operation, created_at,
+	trace_id, span_id, instance_id, client_id, cache_hit, compute_duration_ns FROM calculator_history`
+
+func recordArgs(record *HistoryRecord) []any {
+	return []any{
+		record.UUID, record.Input1, record.Input2, record.Result, record.Operation, record.CreatedAt.UTC(),
+		record.TraceID, record.SpanID, record.InstanceID, record.ClientID, record.CacheHit, int64(record.ComputeDuration),
+	}
+}
+
+// insertQuery returns an INSERT of rows records that skips records whose UUID
+// is already stored. The conflict target is left out because a partitioned
+// PostgreSQL table can only enforce UUIDs unique together with created_at,
+// which a replayed record carries unchanged. placeholder returns the bind
+// parameter for the 1-based position n.
+func insertQuery(rows int, placeholder func(n int) string) string {
+	var query strings.Builder
+	fmt.Fprintf(&query, "INSERT INTO calculator_history (%s) VALUES ", strings.Join(insertColumns, ", "))
+	for row := range rows {
+		if row > 0 {
+			query.WriteString(", ")
+		}
+		query.WriteString("(")
+		for col := range insertColumns {
+			if col > 0 {
+				query.WriteString(", ")
+			}
+			query.WriteString(placeholder(row*len(insertColumns) + col + 1))
+		}
+		query.WriteString(")")
+	}
+	query.WriteString(" ON CONFLICT DO NOTHING")
+
+	return query.String()
+}
+
+// insertBatch writes records with multi-row INSERT statements.
+func insertBatch(ctx context.Context, db *sql.DB, records []*HistoryRecord, placeholder func(n int) string) error {
+	for start := 0; start < len(records); start += maxBatchRows {
+		chunk := records[start:min(start+maxBatchRows, len(records))]
+
+		args := make([]any, 0, len(chunk)*len(insertColumns))
+		for _, record := range chunk {
+			args = append(args, recordArgs(record)...)
+		}
+
+		if _, err := db.ExecContext(ctx, insertQuery(len(chunk), placeholder), args...); err != nil {
+			return fmt.Errorf("failed to write batch of %d records: %w", len(chunk), err)
+		}
+	}
+
+	return nil
+}
+
+// scanHistory reads the rows of a selectHistory query.
+func scanHistory(rows *sql.Rows) ([]*HistoryRecord, error) {
+	defer rows.Close()
+
+	var historyRecords []*HistoryRecord
+	for rows.Next() {
+		var record HistoryRecord
+		var recordUUID sql.NullString
+		var computeDuration int64
+		if err := rows.Scan(&record.ID, &recordUUID, &record.Input1, &record.Input2, &record.Result, &record.Operation, &record.CreatedAt,
+			&record.TraceID, &record.SpanID, &record.InstanceID, &record.ClientID, &record.CacheHit, &computeDuration); err != nil {
+			return nil, fmt.Errorf("failed to scan history record: %w", err)
+		}
+		record.UUID = recordUUID.String
+		record.ComputeDuration = time.Duration(computeDuration)
+		historyRecords = append(historyRecords, &record)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over history records: %w", err)
+	}
+
+	return historyRecords, nil
+}
+
+func postgresPlaceholder(n int) string {
+	return fmt.Sprintf("$%d", n)
+}
+
+func sqlitePlaceholder(int) string {
+	return "?"
+}
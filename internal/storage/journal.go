@@ -0,0 +1,317 @@
+package storage
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"calculator-otel/internal/logger"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+var crcTable = crc32.MakeTable(crc32.Castagnoli)
+
+// Journal is an append-only file of history records that could not be
+// written to the database. Every line holds the CRC-32C of a JSON encoded
+// record followed by the record, so a torn or corrupted line is detected and
+// skipped on replay instead of poisoning the rest of the file.
+type Journal struct {
+	path string
+	mu   sync.Mutex
+}
+
+func OpenJournal(path string) (*Journal, error) {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history journal: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return nil, fmt.Errorf("failed to open history journal: %w", err)
+	}
+
+	return &Journal{path: path}, nil
+}
+
+// Append durably adds records to the journal.
+func (j *Journal) Append(records ...*HistoryRecord) error {
+	var buf bytes.Buffer
+	for _, record := range records {
+		payload, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("failed to encode journal record: %w", err)
+		}
+		fmt.Fprintf(&buf, "%08x %s\n", crc32.Checksum(payload, crcTable), payload)
+	}
+
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	f, err := os.OpenFile(j.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open history journal: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to append to history journal: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync history journal: %w", err)
+	}
+
+	return nil
+}
+
+// replayPath is where the journal is moved while it is being replayed, so
+// that new failures keep appending to a fresh file.
+func (j *Journal) replayPath() string {
+	return j.path + ".replay"
+}
+
+// takeForReplay moves the journal aside for replay and reads it back. A
+// journal left aside by an earlier, failed replay is taken first.
+func (j *Journal) takeForReplay() (records []*HistoryRecord, corrupt int, err error) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+
+	if _, err := os.Stat(j.replayPath()); errors.Is(err, os.ErrNotExist) {
+		info, err := os.Stat(j.path)
+		if err != nil || info.Size() == 0 {
+			return nil, 0, nil
+		}
+		if err := os.Rename(j.path, j.replayPath()); err != nil {
+			return nil, 0, fmt.Errorf("failed to rotate history journal: %w", err)
+		}
+	}
+
+	return readJournal(j.replayPath())
+}
+
+// commitReplay discards the journal taken for replay once its records are
+// stored.
+func (j *Journal) commitReplay() error {
+	return os.Remove(j.replayPath())
+}
+
+func readJournal(path string) (records []*HistoryRecord, corrupt int, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to open history journal: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		sum, payload, ok := bytes.Cut(scanner.Bytes(), []byte(" "))
+		if !ok {
+			corrupt++
+			continue
+		}
+		want, err := strconv.ParseUint(string(sum), 16, 32)
+		if err != nil || uint32(want) != crc32.Checksum(payload, crcTable) {
+			corrupt++
+			continue
+		}
+
+		var record HistoryRecord
+		if err := json.Unmarshal(payload, &record); err != nil {
+			corrupt++
+			continue
+		}
+		records = append(records, &record)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, 0, fmt.Errorf("failed to read history journal: %w", err)
+	}
+
+	return records, corrupt, nil
+}
+
+type JournaledConfig struct {
+	// ReplayInterval is how often the journal is checked for records to
+	// replay.
+	ReplayInterval time.Duration
+	// BatchSize is the number of records replayed per write.
+	BatchSize int
+}
+
+// Journaled is a Storage that appends records to a Journal when the
+// underlying storage fails to write them, and replays the journal in the
+// background once the storage is healthy again. Records carry a UUID, so a
+// record is stored once even if a replay is interrupted and repeated.
+type Journaled struct {
+	next    Storage
+	journal *Journal
+	config  JournaledConfig
+	logger  logger.Logger
+
+	stop chan struct{}
+	done chan struct{}
+
+	journaled metric.Int64Counter
+	replayed  metric.Int64Counter
+}
+
+// NewJournaled starts replaying journal into next. Records left in the
+// journal by a previous run are replayed on the first tick.
+func NewJournaled(next Storage, journal *Journal, config JournaledConfig, logger logger.Logger, meter metric.Meter) (*Journaled, error) {
+	if config.ReplayInterval <= 0 {
+		config.ReplayInterval = 5 * time.Second
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 500
+	}
+
+	j := &Journaled{
+		next:    next,
+		journal: journal,
+		config:  config,
+		logger:  logger,
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	var err error
+	if j.journaled, err = meter.Int64Counter("history.journal.appended",
+		metric.WithUnit("{record}"), metric.WithDescription("History records written to the local journal after a failed write")); err != nil {
+		return nil, err
+	}
+	if j.replayed, err = meter.Int64Counter("history.journal.replayed",
+		metric.WithUnit("{record}"), metric.WithDescription("History records read back from the local journal, by outcome")); err != nil {
+		return nil, err
+	}
+
+	go j.run()
+
+	return j, nil
+}
+
+func (j *Journaled) Write(ctx context.Context, record *HistoryRecord) error {
+	err := j.next.Write(ctx, record)
+	if err == nil {
+		return nil
+	}
+
+	return j.fallback(ctx, err, record)
+}
+
+func (j *Journaled) WriteBatch(ctx context.Context, records []*HistoryRecord) error {
+	err := writeBatch(ctx, j.next, records)
+	if err == nil {
+		return nil
+	}
+
+	return j.fallback(ctx, err, records...)
+}
+
+func (j *Journaled) GetHistory(ctx context.Context, limit int) ([]*HistoryRecord, error) {
+	return j.next.GetHistory(ctx, limit)
+}
+
+func (j *Journaled) GetHistoryByTraceID(ctx context.Context, traceID string) ([]*HistoryRecord, error) {
+	return j.next.GetHistoryByTraceID(ctx, traceID)
+}
+
+// Journal returns the journal records are appended to.
+func (j *Journaled) Journal() *Journal {
+	return j.journal
+}
+
+// Close stops the background replayer.
+func (j *Journaled) Close() {
+	close(j.stop)
+	<-j.done
+}
+
+func (j *Journaled) fallback(ctx context.Context, writeErr error, records ...*HistoryRecord) error {
+	if err := j.journal.Append(records...); err != nil {
+		return errors.Join(writeErr, err)
+	}
+
+	j.journaled.Add(ctx, int64(len(records)))
+	j.logger.WarnContext(ctx, "history write failed, records journaled for replay", "error", writeErr, "records", len(records))
+
+	return nil
+}
+
+func (j *Journaled) run() {
+	defer close(j.done)
+
+	ticker := time.NewTicker(j.config.ReplayInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-j.stop:
+			return
+		case <-ticker.C:
+			j.replay()
+		}
+	}
+}
+
+// replay writes the journaled records back to the underlying storage. The
+// journal is only discarded once every record is stored.
+func (j *Journaled) replay() {
+	ctx, cancel := context.WithTimeout(context.Background(), j.config.ReplayInterval*4)
+	defer cancel()
+
+	if checker, ok := j.next.(HealthChecker); ok {
+		if err := checker.Ping(ctx); err != nil {
+			return
+		}
+	}
+
+	records, corrupt, err := j.journal.takeForReplay()
+	if err != nil {
+		j.logger.ErrorContext(ctx, "failed to read history journal", "error", err)
+		return
+	}
+	if corrupt > 0 {
+		j.replayed.Add(ctx, int64(corrupt), metric.WithAttributes(attribute.String("outcome", "corrupt")))
+		j.logger.WarnContext(ctx, "skipped corrupt history journal entries", "entries", corrupt)
+	}
+	if len(records) == 0 && corrupt == 0 {
+		return
+	}
+
+	for start := 0; start < len(records); start += j.config.BatchSize {
+		batch := records[start:min(start+j.config.BatchSize, len(records))]
+		if err := writeBatch(ctx, j.next, batch); err != nil {
+			j.logger.WarnContext(ctx, "history journal replay failed, will retry", "error", err, "pending", len(records)-start)
+			return
+		}
+		j.replayed.Add(ctx, int64(len(batch)), metric.WithAttributes(attribute.String("outcome", "stored")))
+	}
+
+	if err := j.journal.commitReplay(); err != nil {
+		j.logger.ErrorContext(ctx, "failed to remove replayed history journal", "error", err)
+		return
+	}
+	j.logger.InfoContext(ctx, "replayed history journal", "records", len(records))
+}
+
+// writeBatch writes records to s in one round trip when s supports it.
+func writeBatch(ctx context.Context, s Storage, records []*HistoryRecord) error {
+	if batcher, ok := s.(BatchWriter); ok {
+		return batcher.WriteBatch(ctx, records)
+	}
+
+	for _, record := range records {
+		if err := s.Write(ctx, record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,65 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Leader elects one of the replicas sharing a PostgreSQL database to run a
+// background task. The elected replica holds a session advisory lock on a
+// dedicated connection, so leadership passes on as soon as that connection or
+// the replica goes away.
+type Leader struct {
+	db   *sql.DB
+	key  int64
+	conn *sql.Conn
+}
+
+// NewLeader returns an election for the task identified by key. Replicas
+// compete for the same task by using the same key.
+func NewLeader(db *sql.DB, key int64) *Leader {
+	return &Leader{db: db, key: key}
+}
+
+// Acquire reports whether this replica is the leader, trying to become it
+// when it is not. It is safe to call repeatedly; a leader stays leader until
+// Release or until its connection breaks.
+func (l *Leader) Acquire(ctx context.Context) (bool, error) {
+	if l.conn != nil {
+		if err := l.conn.PingContext(ctx); err == nil {
+			return true, nil
+		}
+		l.conn.Close()
+		l.conn = nil
+	}
+
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to get connection: %w", err)
+	}
+
+	var acquired bool
+	if err := conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1)`, l.key).Scan(&acquired); err != nil {
+		conn.Close()
+		return false, fmt.Errorf("failed to try leader lock: %w", err)
+	}
+	if !acquired {
+		conn.Close()
+		return false, nil
+	}
+
+	l.conn = conn
+	return true, nil
+}
+
+// Release gives up leadership.
+func (l *Leader) Release(ctx context.Context) {
+	if l.conn == nil {
+		return
+	}
+
+	l.conn.ExecContext(ctx, `SELECT pg_advisory_unlock($1)`, l.key)
+	l.conn.Close()
+	l.conn = nil
+}
@@ -0,0 +1,119 @@
+package storage
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// memoryDb keeps the most recent history records in a fixed size ring buffer.
+// It needs no database, which makes it suitable for demos and tests.
+type memoryDb struct {
+	mu      sync.RWMutex
+	records []HistoryRecord
+	// uuids indexes the UUIDs of the records currently in the ring.
+	uuids map[string]struct{}
+	// next is the ring position the next record is written to.
+	next   int
+	size   int
+	lastID int
+	lastAt time.Time
+}
+
+// NewMemoryDb returns an in-memory Storage that retains at most capacity
+// records, discarding the oldest once full.
+func NewMemoryDb(capacity int) Storage {
+	if capacity <= 0 {
+		capacity = 1
+	}
+
+	return &memoryDb{
+		records: make([]HistoryRecord, capacity),
+		uuids:   make(map[string]struct{}, capacity),
+	}
+}
+
+func (m *memoryDb) Write(ctx context.Context, record *HistoryRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.append(*record)
+
+	return nil
+}
+
+func (m *memoryDb) WriteBatch(ctx context.Context, records []*HistoryRecord) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, record := range records {
+		m.append(*record)
+	}
+
+	return nil
+}
+
+// append stores record with the next ID unless its UUID is already present.
+// m.mu must be held.
+func (m *memoryDb) append(record HistoryRecord) {
+	if record.UUID != "" {
+		if _, ok := m.uuids[record.UUID]; ok {
+			return
+		}
+	}
+
+	// Keep CreatedAt in step with ID even if the wall clock steps back.
+	if record.CreatedAt.IsZero() {
+		record.CreatedAt = time.Now().UTC()
+	}
+	if record.CreatedAt.Before(m.lastAt) {
+		record.CreatedAt = m.lastAt
+	}
+	m.lastAt = record.CreatedAt
+	m.lastID++
+	record.ID = m.lastID
+
+	if m.size == len(m.records) {
+		delete(m.uuids, m.records[m.next].UUID)
+	}
+	if record.UUID != "" {
+		m.uuids[record.UUID] = struct{}{}
+	}
+
+	m.records[m.next] = record
+	m.next = (m.next + 1) % len(m.records)
+	m.size = min(m.size+1, len(m.records))
+}
+
+func (m *memoryDb) GetHistory(ctx context.Context, limit int) ([]*HistoryRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	count := m.size
+	if limit > 0 {
+		count = min(count, limit)
+	}
+
+	historyRecords := make([]*HistoryRecord, 0, count)
+	for i := 1; i <= count; i++ {
+		record := m.records[(m.next-i+len(m.records))%len(m.records)]
+		historyRecords = append(historyRecords, &record)
+	}
+
+	return historyRecords, nil
+}
+
+func (m *memoryDb) GetHistoryByTraceID(ctx context.Context, traceID string) ([]*HistoryRecord, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var historyRecords []*HistoryRecord
+	for i := 1; i <= m.size; i++ {
+		record := m.records[(m.next-i+len(m.records))%len(m.records)]
+		if record.TraceID == traceID {
+			historyRecords = append(historyRecords, &record)
+		}
+	}
+
+	return historyRecords, nil
+}
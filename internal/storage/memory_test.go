@@ -0,0 +1,20 @@
+package storage_test
+
+import (
+	"testing"
+
+	"calculator-otel/internal/storage"
+	"calculator-otel/internal/storage/storagetest"
+)
+
+func TestMemoryDb(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return storage.NewMemoryDb(1000)
+	})
+}
+
+func BenchmarkMemoryDb(b *testing.B) {
+	storagetest.Bench(b, func(b *testing.B) storage.Storage {
+		return storage.NewMemoryDb(1000)
+	})
+}
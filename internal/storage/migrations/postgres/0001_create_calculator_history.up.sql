@@ -1,4 +1,4 @@
-CREATE TABLE calculator_history (
+CREATE TABLE IF NOT EXISTS calculator_history (
     id SERIAL PRIMARY KEY,
     input1 NUMERIC NOT NULL,
     input2 NUMERIC NOT NULL,
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS calculator_history_record_uuid_key;
+ALTER TABLE calculator_history DROP COLUMN IF EXISTS record_uuid;
@@ -0,0 +1,2 @@
+ALTER TABLE calculator_history ADD COLUMN IF NOT EXISTS record_uuid UUID;
+CREATE UNIQUE INDEX IF NOT EXISTS calculator_history_record_uuid_key ON calculator_history (record_uuid);
@@ -0,0 +1,8 @@
+DROP INDEX IF EXISTS calculator_history_trace_id_idx;
+ALTER TABLE calculator_history
+    DROP COLUMN IF EXISTS compute_duration_ns,
+    DROP COLUMN IF EXISTS cache_hit,
+    DROP COLUMN IF EXISTS client_id,
+    DROP COLUMN IF EXISTS instance_id,
+    DROP COLUMN IF EXISTS span_id,
+    DROP COLUMN IF EXISTS trace_id;
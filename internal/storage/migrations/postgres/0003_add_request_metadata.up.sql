@@ -0,0 +1,8 @@
+ALTER TABLE calculator_history
+    ADD COLUMN IF NOT EXISTS trace_id VARCHAR(32) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS span_id VARCHAR(16) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS instance_id TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS client_id TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS cache_hit BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN IF NOT EXISTS compute_duration_ns BIGINT NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS calculator_history_trace_id_idx ON calculator_history (trace_id);
@@ -0,0 +1,34 @@
+ALTER TABLE calculator_history RENAME TO calculator_history_partitioned;
+ALTER TABLE calculator_history_partitioned RENAME CONSTRAINT calculator_history_pkey TO calculator_history_partitioned_pkey;
+ALTER SEQUENCE calculator_history_id_seq OWNED BY NONE;
+DROP INDEX IF EXISTS calculator_history_record_uuid_key;
+DROP INDEX IF EXISTS calculator_history_trace_id_idx;
+DROP INDEX IF EXISTS calculator_history_created_at_idx;
+
+CREATE TABLE calculator_history (
+    id INTEGER PRIMARY KEY DEFAULT nextval('calculator_history_id_seq'),
+    record_uuid UUID,
+    input1 NUMERIC NOT NULL,
+    input2 NUMERIC NOT NULL,
+    result NUMERIC NOT NULL,
+    operation VARCHAR(20) NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    trace_id VARCHAR(32) NOT NULL DEFAULT '',
+    span_id VARCHAR(16) NOT NULL DEFAULT '',
+    instance_id TEXT NOT NULL DEFAULT '',
+    client_id TEXT NOT NULL DEFAULT '',
+    cache_hit BOOLEAN NOT NULL DEFAULT FALSE,
+    compute_duration_ns BIGINT NOT NULL DEFAULT 0
+);
+
+CREATE UNIQUE INDEX calculator_history_record_uuid_key ON calculator_history (record_uuid);
+CREATE INDEX calculator_history_trace_id_idx ON calculator_history (trace_id);
+
+INSERT INTO calculator_history (id, record_uuid, input1, input2, result, operation, created_at,
+    trace_id, span_id, instance_id, client_id, cache_hit, compute_duration_ns)
+SELECT id, record_uuid, input1, input2, result, operation, created_at,
+    trace_id, span_id, instance_id, client_id, cache_hit, compute_duration_ns
+FROM calculator_history_partitioned;
+
+ALTER SEQUENCE calculator_history_id_seq OWNED BY calculator_history.id;
+DROP TABLE calculator_history_partitioned;
@@ -0,0 +1,42 @@
+-- Rebuild calculator_history as a table range partitioned on created_at. Rows
+-- outside every ranged partition land in calculator_history_default, which the
+-- partition maintenance task empties into ranged partitions as it creates
+-- them. Unique constraints of a partitioned table must include the partition
+-- key, so record UUIDs are now unique together with their creation time.
+ALTER TABLE calculator_history RENAME TO calculator_history_unpartitioned;
+ALTER TABLE calculator_history_unpartitioned RENAME CONSTRAINT calculator_history_pkey TO calculator_history_unpartitioned_pkey;
+ALTER SEQUENCE calculator_history_id_seq OWNED BY NONE;
+DROP INDEX IF EXISTS calculator_history_record_uuid_key;
+DROP INDEX IF EXISTS calculator_history_trace_id_idx;
+
+CREATE TABLE calculator_history (
+    id INTEGER NOT NULL DEFAULT nextval('calculator_history_id_seq'),
+    record_uuid UUID,
+    input1 NUMERIC NOT NULL,
+    input2 NUMERIC NOT NULL,
+    result NUMERIC NOT NULL,
+    operation VARCHAR(20) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    trace_id VARCHAR(32) NOT NULL DEFAULT '',
+    span_id VARCHAR(16) NOT NULL DEFAULT '',
+    instance_id TEXT NOT NULL DEFAULT '',
+    client_id TEXT NOT NULL DEFAULT '',
+    cache_hit BOOLEAN NOT NULL DEFAULT FALSE,
+    compute_duration_ns BIGINT NOT NULL DEFAULT 0,
+    PRIMARY KEY (id, created_at)
+) PARTITION BY RANGE (created_at);
+
+CREATE UNIQUE INDEX calculator_history_record_uuid_key ON calculator_history (record_uuid, created_at);
+CREATE INDEX calculator_history_trace_id_idx ON calculator_history (trace_id);
+CREATE INDEX calculator_history_created_at_idx ON calculator_history (created_at DESC, id DESC);
+
+CREATE TABLE calculator_history_default PARTITION OF calculator_history DEFAULT;
+
+INSERT INTO calculator_history (id, record_uuid, input1, input2, result, operation, created_at,
+    trace_id, span_id, instance_id, client_id, cache_hit, compute_duration_ns)
+SELECT id, record_uuid, input1, input2, result, operation, COALESCE(created_at, CURRENT_TIMESTAMP),
+    trace_id, span_id, instance_id, client_id, cache_hit, compute_duration_ns
+FROM calculator_history_unpartitioned;
+
+ALTER SEQUENCE calculator_history_id_seq OWNED BY calculator_history.id;
+DROP TABLE calculator_history_unpartitioned;
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS calculator_history (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    input1 NUMERIC NOT NULL,
+    input2 NUMERIC NOT NULL,
+    result NUMERIC NOT NULL,
+    operation VARCHAR(20) NOT NULL,
+    created_at TIMESTAMP DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now'))
+);
@@ -0,0 +1,2 @@
+ALTER TABLE calculator_history ADD COLUMN record_uuid TEXT;
+CREATE UNIQUE INDEX IF NOT EXISTS calculator_history_record_uuid_key ON calculator_history (record_uuid);
@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS calculator_history_trace_id_idx;
+ALTER TABLE calculator_history DROP COLUMN compute_duration_ns;
+ALTER TABLE calculator_history DROP COLUMN cache_hit;
+ALTER TABLE calculator_history DROP COLUMN client_id;
+ALTER TABLE calculator_history DROP COLUMN instance_id;
+ALTER TABLE calculator_history DROP COLUMN span_id;
+ALTER TABLE calculator_history DROP COLUMN trace_id;
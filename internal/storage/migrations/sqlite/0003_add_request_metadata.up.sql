@@ -0,0 +1,7 @@
+ALTER TABLE calculator_history ADD COLUMN trace_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE calculator_history ADD COLUMN span_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE calculator_history ADD COLUMN instance_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE calculator_history ADD COLUMN client_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE calculator_history ADD COLUMN cache_hit BOOLEAN NOT NULL DEFAULT FALSE;
+ALTER TABLE calculator_history ADD COLUMN compute_duration_ns INTEGER NOT NULL DEFAULT 0;
+CREATE INDEX IF NOT EXISTS calculator_history_trace_id_idx ON calculator_history (trace_id);
@@ -3,10 +3,25 @@ package storage
 import "time"
 
 type HistoryRecord struct {
-	ID        int
+	ID int
+	// UUID is generated by the writer so that a record replayed from the
+	// journal is inserted at most once.
+	UUID      string
 	Input1    int
 	Input2    int
 	Result    int
 	Operation string
 	CreatedAt time.Time
+
+	// TraceID and SpanID identify the span that served the calculation.
+	TraceID string
+	SpanID  string
+	// InstanceID is the service.instance.id of the replica that served it.
+	InstanceID string
+	// ClientID identifies the caller, as reported by the app layer.
+	ClientID string
+	CacheHit bool
+	// ComputeDuration is the time spent computing the result, zero for cache
+	// hits.
+	ComputeDuration time.Duration
 }
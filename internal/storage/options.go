@@ -0,0 +1,125 @@
+package storage
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// TLS modes understood by the PostgreSQL driver.
+const (
+	SSLModeDisable    = "disable"
+	SSLModeRequire    = "require"
+	SSLModeVerifyCA   = "verify-ca"
+	SSLModeVerifyFull = "verify-full"
+)
+
+type Config struct {
+	// DSN is a complete connection string, as key=value pairs or a
+	// postgres:// URL. When set, it is used instead of the connection and
+	// TLS fields below.
+	DSN string
+
+	Username string
+	Password string
+	Host     string
+	Port     int
+	Database string
+	TLS      PostgresTLS
+
+	Pool PoolConfig
+	// ConnectTimeout bounds how long opening the primary waits for it to
+	// answer, retrying with exponential backoff.
+	ConnectTimeout time.Duration
+
+	// Replicas are the host:port addresses of streaming replicas that serve
+	// history reads.
+	Replicas []string
+	// MaxReplicaLag is the replication delay above which a replica stops
+	// serving reads until it catches up.
+	MaxReplicaLag time.Duration
+	// ReplicaCheckInterval is how often replica lag is measured.
+	ReplicaCheckInterval time.Duration
+}
+
+type PostgresTLS struct {
+	// Mode is one of the SSLMode constants; empty disables TLS.
+	Mode     string
+	CAFile   string
+	CertFile string
+	KeyFile  string
+}
+
+// PoolConfig tunes the connection pool of every PostgreSQL node. Zero values
+// keep the defaults.
+type PoolConfig struct {
+	MaxOpenConns    int
+	MaxIdleConns    int
+	ConnMaxLifetime time.Duration
+	ConnMaxIdleTime time.Duration
+}
+
+// connString returns the driver connection string for the node at host and
+// port. An empty host selects the node named by the configuration.
+func (c *Config) connString(host string, port int) (string, error) {
+	if c.DSN != "" {
+		dsn := c.DSN
+		if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+			var err error
+			if dsn, err = pq.ParseURL(dsn); err != nil {
+				return "", fmt.Errorf("invalid PostgreSQL DSN: %w", err)
+			}
+		}
+		if host != "" {
+			// Later parameters take precedence over earlier ones.
+			dsn += " host=" + quoteConnValue(host) + " port=" + strconv.Itoa(port)
+		}
+		return dsn, nil
+	}
+
+	if host == "" {
+		host, port = c.Host, c.Port
+	}
+
+	mode := c.TLS.Mode
+	switch mode {
+	case "":
+		mode = SSLModeDisable
+	case SSLModeDisable, SSLModeRequire, SSLModeVerifyCA, SSLModeVerifyFull:
+	default:
+		return "", fmt.Errorf("unknown PostgreSQL TLS mode %q", mode)
+	}
+
+	params := []string{
+		"user=" + quoteConnValue(c.Username),
+		"password=" + quoteConnValue(c.Password),
+		"host=" + quoteConnValue(host),
+		"port=" + strconv.Itoa(port),
+		"dbname=" + quoteConnValue(c.Database),
+		"sslmode=" + mode,
+	}
+	for _, param := range [][2]string{
+		{"sslrootcert", c.TLS.CAFile},
+		{"sslcert", c.TLS.CertFile},
+		{"sslkey", c.TLS.KeyFile},
+	} {
+		if param[1] != "" {
+			params = append(params, param[0]+"="+quoteConnValue(param[1]))
+		}
+	}
+
+	return strings.Join(params, " "), nil
+}
+
+// quoteConnValue quotes a key=value connection string value when it is empty
+// or contains characters that would otherwise end it.
+func quoteConnValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, ` '\`) {
+		return value
+	}
+
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
@@ -0,0 +1,228 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// PartitionInterval is the time range covered by one partition of the
+// PostgreSQL history table.
+type PartitionInterval string
+
+const (
+	PartitionDaily   PartitionInterval = "day"
+	PartitionMonthly PartitionInterval = "month"
+)
+
+const (
+	partitionPrefix  = "calculator_history_p"
+	defaultPartition = "calculator_history_default"
+	// partitionBoundFormat formats partition bounds as TIMESTAMP literals.
+	partitionBoundFormat = "2006-01-02 15:04:05"
+)
+
+type PartitionConfig struct {
+	Interval PartitionInterval
+	// Premake is the number of partitions kept ready after the current one.
+	Premake int
+	// Retention drops partitions whose rows are all older than this. Zero
+	// keeps history forever.
+	Retention time.Duration
+}
+
+// PartitionReport describes the changes made by one maintenance run.
+type PartitionReport struct {
+	Created []string
+	Dropped []string
+	// Purged counts the expired rows deleted from the default partition.
+	Purged int64
+}
+
+// Partitioner maintains the range partitions of the PostgreSQL history table:
+// it creates partitions ahead of time and drops the ones past the retention
+// window. Partitions are named after the period they cover, such as
+// calculator_history_p2025_06 or calculator_history_p2025_06_01.
+type Partitioner struct {
+	db     *sql.DB
+	config PartitionConfig
+}
+
+func NewPartitioner(db *sql.DB, config PartitionConfig) (*Partitioner, error) {
+	switch config.Interval {
+	case PartitionDaily, PartitionMonthly:
+	default:
+		return nil, fmt.Errorf("unknown partition interval %q", config.Interval)
+	}
+	if config.Premake < 0 {
+		config.Premake = 0
+	}
+
+	return &Partitioner{db: db, config: config}, nil
+}
+
+type partition struct {
+	name       string
+	start, end time.Time
+}
+
+// Maintain creates the partitions for the current and the next Premake
+// periods and enforces the retention window, as of now.
+func (p *Partitioner) Maintain(ctx context.Context, now time.Time) (*PartitionReport, error) {
+	existing, err := p.partitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &PartitionReport{}
+	start := p.truncate(now.UTC())
+	for range p.config.Premake + 1 {
+		next := p.partition(start)
+		start = next.end
+		if overlapsAny(next, existing) {
+			continue
+		}
+		if err := p.create(ctx, next); err != nil {
+			return report, err
+		}
+		existing = append(existing, next)
+		report.Created = append(report.Created, next.name)
+	}
+
+	if p.config.Retention <= 0 {
+		return report, nil
+	}
+
+	cutoff := now.UTC().Add(-p.config.Retention)
+	for _, part := range existing {
+		if part.end.After(cutoff) {
+			continue
+		}
+		if err := p.drop(ctx, part); err != nil {
+			return report, err
+		}
+		report.Dropped = append(report.Dropped, part.name)
+	}
+
+	result, err := p.db.ExecContext(ctx, `DELETE FROM `+defaultPartition+` WHERE created_at < $1`, cutoff.Format(partitionBoundFormat))
+	if err != nil {
+		return report, fmt.Errorf("failed to purge expired history: %w", err)
+	}
+	report.Purged, _ = result.RowsAffected()
+
+	return report, nil
+}
+
+// partitions lists the ranged partitions of the history table.
+func (p *Partitioner) partitions(ctx context.Context) ([]partition, error) {
+	rows, err := p.db.QueryContext(ctx, `SELECT child.relname FROM pg_inherits
+		JOIN pg_class parent ON parent.oid = pg_inherits.inhparent
+		JOIN pg_class child ON child.oid = pg_inherits.inhrelid
+		WHERE parent.relname = 'calculator_history'`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list history partitions: %w", err)
+	}
+	defer rows.Close()
+
+	var partitions []partition
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, fmt.Errorf("failed to scan history partition: %w", err)
+		}
+		if part, ok := parsePartition(name); ok {
+			partitions = append(partitions, part)
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over history partitions: %w", err)
+	}
+
+	return partitions, nil
+}
+
+// create adds part to the history table, moving into it any rows of its range
+// that were stored in the default partition meanwhile. PostgreSQL refuses to
+// attach a partition while the default partition holds rows of its range.
+func (p *Partitioner) create(ctx context.Context, part partition) error {
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	start, end := part.start.Format(partitionBoundFormat), part.end.Format(partitionBoundFormat)
+	statements := []string{
+		fmt.Sprintf(`CREATE TABLE %s (LIKE calculator_history INCLUDING DEFAULTS)`, part.name),
+		fmt.Sprintf(`INSERT INTO %s SELECT * FROM %s WHERE created_at >= '%s' AND created_at < '%s'`, part.name, defaultPartition, start, end),
+		fmt.Sprintf(`DELETE FROM %s WHERE created_at >= '%s' AND created_at < '%s'`, defaultPartition, start, end),
+		fmt.Sprintf(`ALTER TABLE calculator_history ATTACH PARTITION %s FOR VALUES FROM ('%s') TO ('%s')`, part.name, start, end),
+	}
+	for _, statement := range statements {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("failed to create history partition %s: %w", part.name, err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (p *Partitioner) drop(ctx context.Context, part partition) error {
+	if _, err := p.db.ExecContext(ctx, fmt.Sprintf(`ALTER TABLE calculator_history DETACH PARTITION %s`, part.name)); err != nil {
+		return fmt.Errorf("failed to detach history partition %s: %w", part.name, err)
+	}
+	if _, err := p.db.ExecContext(ctx, fmt.Sprintf(`DROP TABLE %s`, part.name)); err != nil {
+		return fmt.Errorf("failed to drop history partition %s: %w", part.name, err)
+	}
+
+	return nil
+}
+
+func (p *Partitioner) truncate(t time.Time) time.Time {
+	if p.config.Interval == PartitionDaily {
+		return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+	}
+
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// partition returns the partition of the period starting at start.
+func (p *Partitioner) partition(start time.Time) partition {
+	if p.config.Interval == PartitionDaily {
+		return partition{name: partitionPrefix + start.Format("2006_01_02"), start: start, end: start.AddDate(0, 0, 1)}
+	}
+
+	return partition{name: partitionPrefix + start.Format("2006_01"), start: start, end: start.AddDate(0, 1, 0)}
+}
+
+// parsePartition recovers the range of a partition from its name. Both
+// layouts are recognised so that changing the interval keeps the partitions
+// made before.
+func parsePartition(name string) (partition, bool) {
+	period, ok := strings.CutPrefix(name, partitionPrefix)
+	if !ok {
+		return partition{}, false
+	}
+
+	if start, err := time.Parse("2006_01_02", period); err == nil {
+		return partition{name: name, start: start, end: start.AddDate(0, 0, 1)}, true
+	}
+	if start, err := time.Parse("2006_01", period); err == nil {
+		return partition{name: name, start: start, end: start.AddDate(0, 1, 0)}, true
+	}
+
+	return partition{}, false
+}
+
+func overlapsAny(part partition, partitions []partition) bool {
+	for _, other := range partitions {
+		if part.start.Before(other.end) && other.start.Before(part.end) {
+			return true
+		}
+	}
+
+	return false
+}
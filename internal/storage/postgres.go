@@ -1,77 +1,139 @@
 package storage
 
 import (
+	"cmp"
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 
 	"github.com/lib/pq"
 	"github.com/uptrace/opentelemetry-go-extra/otelsql"
 	"go.opentelemetry.io/otel/attribute"
-	"go.opentelemetry.io/otel/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.32.0"
 )
 
-type (
-	CloseFn func() error
-	Config  struct {
-		Username string
-		Password string
-		Host     string
-		Port     int
-		Database string
-	}
-)
+type CloseFn func() error
 
 type postgresDb struct {
-	db *sql.DB
+	db     *sql.DB
+	insert *preparedStmt
+	// replicas is nil when reads go to the primary.
+	replicas *replicaSet
 }
 
+// NewPostgresDb connects to the PostgreSQL primary and to any configured
+// replicas. Writes always go to the primary; reads go to a replica whose lag
+// is within config.MaxReplicaLag, or to the primary when there is none.
 func NewPostgresDb(config *Config) (Storage, CloseFn, error) {
-	connector, err := pq.NewConnector(fmt.Sprintf("user=%s password=%s host=%s port=%d dbname=%s sslmode=disable",
-		config.Username, config.Password, config.Host, config.Port, config.Database))
+	db, err := OpenPostgres(config, "history")
 	if err != nil {
-		return nil, nil, fmt.Errorf("failed to create PostgreSQL connector: %w", err)
+		return nil, nil, err
 	}
 
-	db := otelsql.OpenDB(connector)
-	db.SetConnMaxIdleTime(5 * time.Minute)
-	db.SetConnMaxLifetime(30 * time.Minute)
-	db.SetMaxIdleConns(10)
-	db.SetMaxOpenConns(100)
-
-	var pingErr error
-	for i := 0; i < 5; i++ {
-		if pingErr = db.Ping(); pingErr == nil {
-			break
-		}
-		if i < 4 {
-			time.Sleep(1 * time.Second)
+	p := &postgresDb{
+		db:     db,
+		insert: newPreparedStmt(db, insertQuery(1, postgresPlaceholder)),
+	}
+	if len(config.Replicas) > 0 {
+		if p.replicas, err = newReplicaSet(config); err != nil {
+			db.Close()
+			return nil, nil, err
 		}
 	}
-	if pingErr != nil {
-		return nil, nil, fmt.Errorf("failed to connect to PostgreSQL after 5 retries: %w", pingErr)
+
+	return p, p.close, nil
+}
+
+func (p *postgresDb) close() error {
+	var errs []error
+	errs = append(errs, p.insert.Close())
+	if p.replicas != nil {
+		errs = append(errs, p.replicas.Close())
 	}
+	errs = append(errs, p.db.Close())
 
-	return &postgresDb{db: db}, db.Close, nil
+	return errors.Join(errs...)
 }
 
-func (p *postgresDb) Write(ctx context.Context, input1, input2, result int, operation string) error {
-	trace.SpanFromContext(ctx).AddEvent("Writing to PostgreSQL", trace.WithAttributes(
-		attribute.Int("input1", input1),
-		attribute.Int("input2", input2),
-		attribute.Int("result", result),
-		attribute.String("operation", operation),
-	))
+// OpenPostgres opens an instrumented connection pool to the PostgreSQL
+// primary and waits until the server answers, backing off exponentially
+// between attempts for up to config.ConnectTimeout. pool names the pool in
+// its connection metrics.
+func OpenPostgres(config *Config, pool string) (*sql.DB, error) {
+	db, err := connectPostgres(config, "", 0, nodePrimary, pool)
+	if err != nil {
+		return nil, err
+	}
 
-	query := `INSERT INTO calculator_history (input1, input2, result, operation) VALUES ($1, $2, $3, $4)`
-	statement, err := p.db.PrepareContext(ctx, query)
+	timeout := config.ConnectTimeout
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	deadline := time.Now().Add(timeout)
+	backoff := 250 * time.Millisecond
+	for {
+		pingErr := db.Ping()
+		if pingErr == nil {
+			return db, nil
+		}
+		if time.Now().Add(backoff).After(deadline) {
+			db.Close()
+			return nil, fmt.Errorf("failed to connect to PostgreSQL within %s: %w", timeout, pingErr)
+		}
+		time.Sleep(backoff)
+		backoff = min(backoff*2, 5*time.Second)
+	}
+}
+
+// connectPostgres returns a connection pool to the PostgreSQL node at host and
+// port, or to the configured node when host is empty. Its query spans are
+// labelled with the node address and role, and its pool statistics are
+// reported as metrics.
+func connectPostgres(config *Config, host string, port int, role, pool string) (*sql.DB, error) {
+	connString, err := config.connString(host, port)
+	if err != nil {
+		return nil, err
+	}
+	connector, err := pq.NewConnector(connString)
 	if err != nil {
-		return fmt.Errorf("failed to prepare statement: %w", err)
+		return nil, fmt.Errorf("failed to create PostgreSQL connector: %w", err)
 	}
-	defer statement.Close()
 
-	_, err = statement.ExecContext(ctx, input1, input2, result, operation)
+	if host == "" && config.DSN == "" {
+		host, port = config.Host, config.Port
+	}
+	attrs := []attribute.KeyValue{
+		attribute.String("db.node.role", role),
+		attribute.String("db.client.connection.pool.name", pool),
+	}
+	if host != "" {
+		attrs = append(attrs, attribute.String("server.address", host), attribute.Int("server.port", port))
+	}
+	options := []otelsql.Option{
+		otelsql.WithDBSystem("postgresql"),
+		otelsql.WithAttributes(attrs...),
+	}
+	if config.Database != "" {
+		options = append(options, otelsql.WithDBName(config.Database))
+	}
+
+	db := otelsql.OpenDB(connector, options...)
+	db.SetConnMaxIdleTime(cmp.Or(config.Pool.ConnMaxIdleTime, 5*time.Minute))
+	db.SetConnMaxLifetime(cmp.Or(config.Pool.ConnMaxLifetime, 30*time.Minute))
+	db.SetMaxIdleConns(cmp.Or(config.Pool.MaxIdleConns, 10))
+	db.SetMaxOpenConns(cmp.Or(config.Pool.MaxOpenConns, 100))
+
+	otelsql.ReportDBStatsMetrics(db, options...)
+
+	return db, nil
+}
+
+func (p *postgresDb) Write(ctx context.Context, record *HistoryRecord) error {
+	annotateSpan(ctx, semconv.DBSystemNamePostgreSQL, "INSERT")
+
+	_, err := p.insert.ExecContext(ctx, recordArgs(record)...)
 	if err != nil {
 		return fmt.Errorf("failed to write to PostgreSQL: %w", err)
 	}
@@ -79,30 +141,51 @@ func (p *postgresDb) Write(ctx context.Context, input1, input2, result int, oper
 	return nil
 }
 
-func (p *postgresDb) GetHistory(ctx context.Context) ([]*HistoryRecord, error) {
-	trace.SpanFromContext(ctx).AddEvent("Retrieving history from PostgreSQL", trace.WithAttributes(
-		attribute.String("operation", "get_history"),
-	))
+func (p *postgresDb) WriteBatch(ctx context.Context, records []*HistoryRecord) error {
+	annotateSpan(ctx, semconv.DBSystemNamePostgreSQL, "INSERT", semconv.DBOperationBatchSize(len(records)))
+
+	return insertBatch(ctx, p.db, records, postgresPlaceholder)
+}
+
+func (p *postgresDb) Ping(ctx context.Context) error {
+	return p.db.PingContext(ctx)
+}
+
+// reader returns the pool that serves reads and the node it belongs to.
+func (p *postgresDb) reader() (*sql.DB, string) {
+	if p.replicas == nil {
+		return p.db, nodePrimary
+	}
+
+	return p.replicas.reader(p.db)
+}
 
-	query := `SELECT id, input1, input2, result, operation, created_at FROM calculator_history ORDER BY created_at DESC`
-	rows, err := p.db.QueryContext(ctx, query)
+func (p *postgresDb) GetHistory(ctx context.Context, limit int) ([]*HistoryRecord, error) {
+	db, node := p.reader()
+	annotateSpan(ctx, semconv.DBSystemNamePostgreSQL, "SELECT", attribute.String("db.node", node))
+
+	query := selectHistory + ` ORDER BY created_at DESC, id DESC`
+	args := []any{}
+	if limit > 0 {
+		query += ` LIMIT $1`
+		args = append(args, limit)
+	}
+	rows, err := db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, fmt.Errorf("failed to query history: %w", err)
 	}
-	defer rows.Close()
 
-	var historyRecords []*HistoryRecord
-	for rows.Next() {
-		var record HistoryRecord
-		if err := rows.Scan(&record.ID, &record.Input1, &record.Input2, &record.Result, &record.Operation, &record.CreatedAt); err != nil {
-			return nil, fmt.Errorf("failed to scan history record: %w", err)
-		}
-		historyRecords = append(historyRecords, &record)
-	}
+	return scanHistory(rows)
+}
+
+func (p *postgresDb) GetHistoryByTraceID(ctx context.Context, traceID string) ([]*HistoryRecord, error) {
+	db, node := p.reader()
+	annotateSpan(ctx, semconv.DBSystemNamePostgreSQL, "SELECT", attribute.String("db.node", node))
 
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating over history records: %w", err)
+	rows, err := db.QueryContext(ctx, selectHistory+` WHERE trace_id = $1 ORDER BY created_at DESC, id DESC`, traceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query history: %w", err)
 	}
 
-	return historyRecords, nil
+	return scanHistory(rows)
 }
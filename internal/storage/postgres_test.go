@@ -0,0 +1,66 @@
+package storage_test
+
+import (
+	"os"
+	"testing"
+
+	"calculator-otel/internal/storage"
+	"calculator-otel/internal/storage/migrations"
+	"calculator-otel/internal/storage/storagetest"
+)
+
+func TestPostgresDb(t *testing.T) {
+	dsn := postgresTestDSN(t)
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return newPostgresDb(t, dsn)
+	})
+}
+
+func BenchmarkPostgresDb(b *testing.B) {
+	dsn := postgresTestDSN(b)
+	storagetest.Bench(b, func(b *testing.B) storage.Storage {
+		return newPostgresDb(b, dsn)
+	})
+}
+
+// postgresTestDSN returns the connection string of a PostgreSQL database that
+// the tests may empty, from POSTGRES_TEST_DSN, skipping the test when it is
+// not set.
+func postgresTestDSN(tb testing.TB) string {
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		tb.Skip("POSTGRES_TEST_DSN is not set")
+	}
+
+	return dsn
+}
+
+// newPostgresDb migrates the test database and empties its history.
+func newPostgresDb(tb testing.TB, dsn string) storage.Storage {
+	config := &storage.Config{DSN: dsn}
+
+	db, err := storage.OpenPostgres(config, "test")
+	if err != nil {
+		tb.Fatalf("OpenPostgres: %v", err)
+	}
+	defer db.Close()
+
+	migrator, err := migrations.New(db, migrations.Postgres)
+	if err != nil {
+		tb.Fatalf("migrations.New: %v", err)
+	}
+	if _, err := migrator.Up(tb.Context()); err != nil {
+		tb.Fatalf("migrating: %v", err)
+	}
+	if _, err := db.ExecContext(tb.Context(), "TRUNCATE calculator_history"); err != nil {
+		tb.Fatalf("emptying history: %v", err)
+	}
+
+	s, closeFn, err := storage.NewPostgresDb(config)
+	if err != nil {
+		tb.Fatalf("NewPostgresDb: %v", err)
+	}
+	tb.Cleanup(func() { closeFn() })
+
+	return s
+}
@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const nodePrimary = "primary"
+
+// lagUnknown marks a replica whose lag could not be measured.
+const lagUnknown = -1
+
+// replicaLagQuery measures how far a standby is behind its primary, in
+// seconds. A standby that has replayed everything it received is not lagging,
+// however long ago the last transaction was, as long as it still streams from
+// the primary; without a streaming WAL receiver its lag is unknown (NULL).
+// Roles without pg_read_all_stats see the receiver but not its status. A
+// server that is not in recovery, such as a promoted standby, never lags.
+const replicaLagQuery = `SELECT CASE
+	WHEN NOT pg_is_in_recovery() THEN 0
+	WHEN NOT EXISTS (
+		SELECT 1 FROM pg_stat_wal_receiver WHERE COALESCE(status, 'streaming') = 'streaming'
+	) THEN NULL
+	WHEN pg_last_wal_receive_lsn() = pg_last_wal_replay_lsn() THEN 0
+	ELSE EXTRACT(EPOCH FROM now() - pg_last_xact_replay_timestamp())
+END`
+
+type replica struct {
+	addr string
+	db   *sql.DB
+	// lag is the last measured replication delay, or lagUnknown.
+	lag atomic.Int64
+}
+
+// replicaSet spreads reads over the replicas whose lag is within maxLag and
+// measures their lag in the background.
+type replicaSet struct {
+	replicas []*replica
+	maxLag   time.Duration
+	interval time.Duration
+	next     atomic.Uint64
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+func newReplicaSet(config *Config) (*replicaSet, error) {
+	r := &replicaSet{
+		maxLag:   config.MaxReplicaLag,
+		interval: config.ReplicaCheckInterval,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	if r.maxLag <= 0 {
+		r.maxLag = 5 * time.Second
+	}
+	if r.interval <= 0 {
+		r.interval = 5 * time.Second
+	}
+
+	for _, addr := range config.Replicas {
+		host, port, err := splitHostPort(addr)
+		if err != nil {
+			r.closeReplicas()
+			return nil, err
+		}
+		db, err := connectPostgres(config, host, port, "replica", "history")
+		if err != nil {
+			r.closeReplicas()
+			return nil, err
+		}
+
+		replica := &replica{addr: addr, db: db}
+		replica.lag.Store(lagUnknown)
+		r.replicas = append(r.replicas, replica)
+	}
+
+	r.check()
+	go r.run()
+
+	return r, nil
+}
+
+// reader returns the next replica within the lag limit, or primary when every
+// replica is lagging or unreachable.
+func (r *replicaSet) reader(primary *sql.DB) (*sql.DB, string) {
+	start := r.next.Add(1)
+	for i := range uint64(len(r.replicas)) {
+		replica := r.replicas[(start+i)%uint64(len(r.replicas))]
+		lag := replica.lag.Load()
+		if lag != lagUnknown && time.Duration(lag) <= r.maxLag {
+			return replica.db, replica.addr
+		}
+	}
+
+	return primary, nodePrimary
+}
+
+func (r *replicaSet) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-r.stop:
+			return
+		case <-ticker.C:
+			r.check()
+		}
+	}
+}
+
+// check measures the lag of every replica.
+func (r *replicaSet) check() {
+	ctx, cancel := context.WithTimeout(context.Background(), r.interval)
+	defer cancel()
+
+	for _, replica := range r.replicas {
+		var seconds sql.NullFloat64
+		if err := replica.db.QueryRowContext(ctx, replicaLagQuery).Scan(&seconds); err != nil || !seconds.Valid {
+			replica.lag.Store(lagUnknown)
+			continue
+		}
+		replica.lag.Store(int64(seconds.Float64 * float64(time.Second)))
+	}
+}
+
+func (r *replicaSet) Close() error {
+	close(r.stop)
+	<-r.done
+
+	return r.closeReplicas()
+}
+
+func (r *replicaSet) closeReplicas() error {
+	var errs []error
+	for _, replica := range r.replicas {
+		errs = append(errs, replica.db.Close())
+	}
+
+	return errors.Join(errs...)
+}
+
+// splitHostPort splits a host:port address, defaulting to the PostgreSQL port.
+func splitHostPort(addr string) (string, int, error) {
+	host, portText, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr, 5432, nil
+	}
+
+	port, err := strconv.Atoi(portText)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid PostgreSQL replica address %q: %w", addr, err)
+	}
+
+	return host, port, nil
+}
@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+
+	"calculator-otel/internal/storage/migrations"
+
+	"github.com/uptrace/opentelemetry-go-extra/otelsql"
+	semconv "go.opentelemetry.io/otel/semconv/v1.32.0"
+	_ "modernc.org/sqlite"
+)
+
+type sqliteDb struct {
+	db *sql.DB
+}
+
+// NewSQLiteDb opens the SQLite database at path, creating it if needed, and
+// brings its schema up to date. A SQLite file belongs to a single server, so
+// unlike PostgreSQL it is always migrated on open.
+func NewSQLiteDb(ctx context.Context, path string) (Storage, CloseFn, error) {
+	db, err := OpenSQLite(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	migrator, err := migrations.New(db, migrations.SQLite)
+	if err != nil {
+		db.Close()
+		return nil, nil, err
+	}
+	if _, err := migrator.Up(ctx); err != nil {
+		db.Close()
+		return nil, nil, fmt.Errorf("failed to migrate SQLite database: %w", err)
+	}
+
+	return &sqliteDb{db: db}, db.Close, nil
+}
+
+// OpenSQLite opens an instrumented handle to the SQLite database at path. The
+// pool is limited to one connection because SQLite allows a single writer,
+// which also keeps ":memory:" databases from being split across connections.
+func OpenSQLite(path string) (*sql.DB, error) {
+	dsn := "file:" + path + "?" + url.Values{
+		"_pragma":      {"busy_timeout(5000)", "journal_mode(WAL)", "foreign_keys(1)"},
+		"_time_format": {"sqlite"},
+	}.Encode()
+
+	db, err := otelsql.Open("sqlite", dsn, otelsql.WithDBSystem("sqlite"))
+	if err != nil {
+		return nil, fmt.Errorf("failed to open SQLite database: %w", err)
+	}
+	db.SetMaxOpenConns(1)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to open SQLite database %s: %w", path, err)
+	}
+
+	return db, nil
+}
+
+func (s *sqliteDb) Write(ctx context.Context, record *HistoryRecord) error {
+	annotateSpan(ctx, semconv.DBSystemNameSQLite, "INSERT")
+
+	_, err := s.db.ExecContext(ctx, insertQuery(1, sqlitePlaceholder), recordArgs(record)...)
+	if err != nil {
+		return fmt.Errorf("failed to write to SQLite: %w", err)
+	}
+
+	return nil
+}
+
+func (s *sqliteDb) WriteBatch(ctx context.Context, records []*HistoryRecord) error {
+	annotateSpan(ctx, semconv.DBSystemNameSQLite, "INSERT", semconv.DBOperationBatchSize(len(records)))
+
+	return insertBatch(ctx, s.db, records, sqlitePlaceholder)
+}
+
+func (s *sqliteDb) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+func (s *sqliteDb) GetHistory(ctx context.Context, limit int) ([]*HistoryRecord, error) {
+	annotateSpan(ctx, semconv.DBSystemNameSQLite, "SELECT")
+
+	query := selectHistory + ` ORDER BY created_at DESC, id DESC`
+	args := []any{}
+	if limit > 0 {
+		query += ` LIMIT ?`
+		args = append(args, limit)
+	}
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query history: %w", err)
+	}
+
+	return scanHistory(rows)
+}
+
+func (s *sqliteDb) GetHistoryByTraceID(ctx context.Context, traceID string) ([]*HistoryRecord, error) {
+	annotateSpan(ctx, semconv.DBSystemNameSQLite, "SELECT")
+
+	rows, err := s.db.QueryContext(ctx, selectHistory+` WHERE trace_id = ? ORDER BY created_at DESC, id DESC`, traceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query history: %w", err)
+	}
+
+	return scanHistory(rows)
+}
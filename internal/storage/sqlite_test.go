@@ -0,0 +1,32 @@
+package storage_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"calculator-otel/internal/storage"
+	"calculator-otel/internal/storage/storagetest"
+)
+
+func TestSQLiteDb(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) storage.Storage {
+		return newSQLiteDb(t)
+	})
+}
+
+func BenchmarkSQLiteDb(b *testing.B) {
+	storagetest.Bench(b, func(b *testing.B) storage.Storage {
+		return newSQLiteDb(b)
+	})
+}
+
+// newSQLiteDb opens a migrated database in a temporary directory.
+func newSQLiteDb(tb testing.TB) storage.Storage {
+	s, closeFn, err := storage.NewSQLiteDb(tb.Context(), filepath.Join(tb.TempDir(), "history.db"))
+	if err != nil {
+		tb.Fatalf("NewSQLiteDb: %v", err)
+	}
+	tb.Cleanup(func() { closeFn() })
+
+	return s
+}
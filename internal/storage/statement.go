@@ -0,0 +1,134 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/lib/pq"
+)
+
+// preparedStmt is a statement prepared on first use and then reused. The
+// underlying sql.Stmt is prepared once per pooled connection, including
+// connections opened after a failover. When the server rejects the prepared
+// plan, as it does after a schema change, the statement is prepared again and
+// the call retried once.
+type preparedStmt struct {
+	db    *sql.DB
+	query string
+
+	mu   sync.Mutex
+	stmt *sharedStmt
+}
+
+// sharedStmt is a prepared statement along with the number of calls using
+// it, so that a discarded statement is closed once the last of them returns.
+type sharedStmt struct {
+	*sql.Stmt
+	users     int
+	discarded bool
+}
+
+func newPreparedStmt(db *sql.DB, query string) *preparedStmt {
+	return &preparedStmt{db: db, query: query}
+}
+
+func (s *preparedStmt) ExecContext(ctx context.Context, args ...any) (sql.Result, error) {
+	stmt, err := s.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := stmt.ExecContext(ctx, args...)
+	if !isStalePlan(err) {
+		s.release(stmt)
+		return result, err
+	}
+
+	s.discard(stmt)
+	s.release(stmt)
+	if stmt, err = s.acquire(ctx); err != nil {
+		return nil, err
+	}
+	defer s.release(stmt)
+
+	return stmt.ExecContext(ctx, args...)
+}
+
+// acquire returns the prepared statement, preparing it if needed. Callers
+// release it when they are done with it.
+func (s *preparedStmt) acquire(ctx context.Context) (*sharedStmt, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stmt == nil {
+		stmt, err := s.db.PrepareContext(ctx, s.query)
+		if err != nil {
+			return nil, fmt.Errorf("failed to prepare statement: %w", err)
+		}
+		s.stmt = &sharedStmt{Stmt: stmt}
+	}
+	s.stmt.users++
+
+	return s.stmt, nil
+}
+
+func (s *preparedStmt) release(stmt *sharedStmt) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	stmt.users--
+	if stmt.discarded && stmt.users == 0 {
+		stmt.Close()
+	}
+}
+
+// discard drops stmt unless another caller has already replaced it. The
+// statement is closed, releasing its server-side copies, once no call uses
+// it anymore.
+func (s *preparedStmt) discard(stmt *sharedStmt) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stmt == stmt {
+		s.stmt = nil
+	}
+	stmt.discarded = true
+}
+
+func (s *preparedStmt) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.stmt == nil {
+		return nil
+	}
+	stmt := s.stmt
+	s.stmt = nil
+	stmt.discarded = true
+	if stmt.users > 0 {
+		return nil
+	}
+
+	return stmt.Close()
+}
+
+// isStalePlan reports whether err means a prepared statement is no longer
+// valid on the server and has to be prepared again.
+func isStalePlan(err error) bool {
+	var pqErr *pq.Error
+	if !errors.As(err, &pqErr) {
+		return false
+	}
+
+	switch pqErr.Code {
+	case "26000": // invalid_sql_statement_name: the statement is gone
+		return true
+	case "0A000": // feature_not_supported: "cached plan must not change result type"
+		return true
+	}
+
+	return false
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"calculator-otel/internal/storage/migrations"
+)
+
+// BenchmarkPostgresInsert compares running the history insert as a one-off
+// query, which the driver prepares on every call, with reusing the prepared
+// statement, against the database in POSTGRES_TEST_DSN.
+func BenchmarkPostgresInsert(b *testing.B) {
+	dsn := os.Getenv("POSTGRES_TEST_DSN")
+	if dsn == "" {
+		b.Skip("POSTGRES_TEST_DSN is not set")
+	}
+
+	db, err := OpenPostgres(&Config{DSN: dsn}, "bench")
+	if err != nil {
+		b.Fatalf("OpenPostgres: %v", err)
+	}
+	defer db.Close()
+
+	migrator, err := migrations.New(db, migrations.Postgres)
+	if err != nil {
+		b.Fatalf("migrations.New: %v", err)
+	}
+	if _, err := migrator.Up(b.Context()); err != nil {
+		b.Fatalf("migrating: %v", err)
+	}
+
+	query := insertQuery(1, postgresPlaceholder)
+	record := func() []any {
+		return recordArgs(&HistoryRecord{UUID: uuid.NewString(), Input1: 1, Input2: 2, Result: 3, Operation: "add", CreatedAt: time.Now().UTC()})
+	}
+
+	b.Run("PreparePerCall", func(b *testing.B) {
+		for b.Loop() {
+			if _, err := db.ExecContext(b.Context(), query, record()...); err != nil {
+				b.Fatalf("insert: %v", err)
+			}
+		}
+	})
+	b.Run("Reuse", func(b *testing.B) {
+		stmt := newPreparedStmt(db, query)
+		defer stmt.Close()
+		for b.Loop() {
+			if _, err := stmt.ExecContext(b.Context(), record()...); err != nil {
+				b.Fatalf("insert: %v", err)
+			}
+		}
+	})
+}
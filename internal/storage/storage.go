@@ -3,6 +3,26 @@ package storage
 import "context"
 
 type Storage interface {
-	Write(ctx context.Context, input1, input2, result int, operation string) error
-	GetHistory(ctx context.Context) ([]*HistoryRecord, error)
+	// Write stores record. A record whose UUID is already stored is ignored.
+	Write(ctx context.Context, record *HistoryRecord) error
+	// GetHistory returns the most recent records first, at most limit of them
+	// when limit is positive.
+	GetHistory(ctx context.Context, limit int) ([]*HistoryRecord, error)
+	// GetHistoryByTraceID returns the records written while serving the given
+	// trace, most recent first.
+	GetHistoryByTraceID(ctx context.Context, traceID string) ([]*HistoryRecord, error)
+}
+
+// HealthChecker is implemented by storages that can report whether their
+// backing database is reachable.
+type HealthChecker interface {
+	Ping(ctx context.Context) error
+}
+
+// BatchWriter is implemented by storages that can insert many records in a
+// single round trip. IDs are assigned by the storage and records whose UUID is
+// already stored are skipped. Implementations must not retain records after
+// returning.
+type BatchWriter interface {
+	WriteBatch(ctx context.Context, records []*HistoryRecord) error
 }
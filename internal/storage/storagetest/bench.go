@@ -0,0 +1,65 @@
+package storagetest
+
+import (
+	"context"
+	"testing"
+
+	"calculator-otel/internal/storage"
+)
+
+// BenchFactory returns an empty Storage for a single benchmark.
+type BenchFactory func(b *testing.B) storage.Storage
+
+// Bench measures the storage returned by newStorage. Against PostgreSQL, the
+// Write benchmarks show the cost of the INSERT round trips that each
+// calculation pays when history is written synchronously.
+func Bench(b *testing.B, newStorage BenchFactory) {
+	b.Run("Write", func(b *testing.B) { benchWrite(b, newStorage(b)) })
+	b.Run("WriteParallel", func(b *testing.B) { benchWriteParallel(b, newStorage(b)) })
+	b.Run("GetHistory", func(b *testing.B) { benchGetHistory(b, newStorage(b)) })
+}
+
+func benchWrite(b *testing.B, s storage.Storage) {
+	ctx := context.Background()
+	b.ReportAllocs()
+
+	i := 0
+	for b.Loop() {
+		if err := s.Write(ctx, newRecord(i, 2, i+2, "add")); err != nil {
+			b.Fatalf("Write: %v", err)
+		}
+		i++
+	}
+}
+
+func benchWriteParallel(b *testing.B, s storage.Storage) {
+	ctx := context.Background()
+	b.ReportAllocs()
+
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			if err := s.Write(ctx, newRecord(i, 3, i*3, "multiply")); err != nil {
+				b.Errorf("Write: %v", err)
+				return
+			}
+			i++
+		}
+	})
+}
+
+func benchGetHistory(b *testing.B, s storage.Storage) {
+	ctx := context.Background()
+	for i := range 1000 {
+		if err := s.Write(ctx, newRecord(i, 1, i-1, "subtract")); err != nil {
+			b.Fatalf("Write: %v", err)
+		}
+	}
+	b.ReportAllocs()
+
+	for b.Loop() {
+		if _, err := s.GetHistory(ctx, 100); err != nil {
+			b.Fatalf("GetHistory: %v", err)
+		}
+	}
+}
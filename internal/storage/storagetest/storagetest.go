@@ -0,0 +1,265 @@
+// Package storagetest provides a conformance suite that every
+// storage.Storage implementation is expected to pass.
+package storagetest
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"calculator-otel/internal/storage"
+
+	"github.com/google/uuid"
+)
+
+// Factory returns an empty Storage for a single subtest. Implementations
+// register any cleanup with t.Cleanup.
+type Factory func(t *testing.T) storage.Storage
+
+// Run runs the conformance suite against the storage returned by newStorage.
+// The storage must be able to hold at least 100 records.
+func Run(t *testing.T, newStorage Factory) {
+	t.Run("EmptyHistory", func(t *testing.T) { testEmptyHistory(t, newStorage(t)) })
+	t.Run("WriteAndRead", func(t *testing.T) { testWriteAndRead(t, newStorage(t)) })
+	t.Run("NewestFirst", func(t *testing.T) { testNewestFirst(t, newStorage(t)) })
+	t.Run("Limit", func(t *testing.T) { testLimit(t, newStorage(t)) })
+	t.Run("ConcurrentWrites", func(t *testing.T) { testConcurrentWrites(t, newStorage(t)) })
+	t.Run("DuplicateUUID", func(t *testing.T) { testDuplicateUUID(t, newStorage(t)) })
+	t.Run("RequestMetadata", func(t *testing.T) { testRequestMetadata(t, newStorage(t)) })
+	t.Run("ByTraceID", func(t *testing.T) { testByTraceID(t, newStorage(t)) })
+}
+
+func newRecord(input1, input2, result int, operation string) *storage.HistoryRecord {
+	return &storage.HistoryRecord{
+		UUID:      uuid.NewString(),
+		Input1:    input1,
+		Input2:    input2,
+		Result:    result,
+		Operation: operation,
+		CreatedAt: time.Now().UTC(),
+	}
+}
+
+func testEmptyHistory(t *testing.T, s storage.Storage) {
+	history, err := s.GetHistory(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	if len(history) != 0 {
+		t.Fatalf("GetHistory on empty storage returned %d records", len(history))
+	}
+}
+
+func testWriteAndRead(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	if err := s.Write(ctx, newRecord(3, -5, -2, "add")); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	history, err := s.GetHistory(ctx, 0)
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	if len(history) != 1 {
+		t.Fatalf("GetHistory returned %d records, want 1", len(history))
+	}
+
+	got := history[0]
+	if got.Input1 != 3 || got.Input2 != -5 || got.Result != -2 || got.Operation != "add" {
+		t.Errorf("GetHistory returned %+v, want inputs 3 and -5, result -2, operation add", got)
+	}
+	if got.ID <= 0 {
+		t.Errorf("record ID = %d, want a positive ID", got.ID)
+	}
+	if got.CreatedAt.IsZero() {
+		t.Error("record CreatedAt is not set")
+	}
+	if got.UUID == "" {
+		t.Error("record UUID is not set")
+	}
+}
+
+func testNewestFirst(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	for i := range 10 {
+		if err := s.Write(ctx, newRecord(i, 1, i+1, "add")); err != nil {
+			t.Fatalf("Write %d: %v", i, err)
+		}
+	}
+
+	history, err := s.GetHistory(ctx, 0)
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	if len(history) != 10 {
+		t.Fatalf("GetHistory returned %d records, want 10", len(history))
+	}
+
+	for i, record := range history {
+		if want := 9 - i; record.Input1 != want {
+			t.Errorf("record %d has input1 %d, want %d", i, record.Input1, want)
+		}
+		if i == 0 {
+			continue
+		}
+		prev := history[i-1]
+		if record.ID >= prev.ID {
+			t.Errorf("record %d has ID %d, not below the newer record's %d", i, record.ID, prev.ID)
+		}
+		if record.CreatedAt.After(prev.CreatedAt) {
+			t.Errorf("record %d created at %v, after the newer record's %v", i, record.CreatedAt, prev.CreatedAt)
+		}
+	}
+}
+
+func testLimit(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	for i := range 5 {
+		if err := s.Write(ctx, newRecord(i, 2, i*2, "multiply")); err != nil {
+			t.Fatalf("Write %d: %v", i, err)
+		}
+	}
+
+	history, err := s.GetHistory(ctx, 3)
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	if len(history) != 3 {
+		t.Fatalf("GetHistory(3) returned %d records", len(history))
+	}
+	if history[0].Input1 != 4 {
+		t.Errorf("GetHistory(3) starts at input1 %d, want the newest record 4", history[0].Input1)
+	}
+}
+
+func testConcurrentWrites(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	const writers, perWriter = 10, 10
+
+	var wg sync.WaitGroup
+	for w := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range perWriter {
+				if err := s.Write(ctx, newRecord(w, i, w-i, "subtract")); err != nil {
+					t.Errorf("Write: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	history, err := s.GetHistory(ctx, 0)
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	if len(history) != writers*perWriter {
+		t.Fatalf("GetHistory returned %d records, want %d", len(history), writers*perWriter)
+	}
+
+	ids := make(map[int]bool, len(history))
+	for _, record := range history {
+		if ids[record.ID] {
+			t.Fatalf("ID %d assigned to more than one record", record.ID)
+		}
+		ids[record.ID] = true
+	}
+}
+
+// testDuplicateUUID checks that writing a record again, as a journal replay
+// does, stores it only once.
+func testDuplicateUUID(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	record := newRecord(6, 3, 2, "divide")
+	for range 2 {
+		if err := s.Write(ctx, record); err != nil {
+			t.Fatalf("Write: %v", err)
+		}
+	}
+
+	history, err := s.GetHistory(ctx, 0)
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	if len(history) != 1 {
+		t.Fatalf("GetHistory returned %d records after writing the same UUID twice, want 1", len(history))
+	}
+	if history[0].UUID != record.UUID {
+		t.Errorf("record UUID = %q, want %q", history[0].UUID, record.UUID)
+	}
+}
+
+func testRequestMetadata(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	record := newRecord(7, 8, 56, "multiply")
+	record.TraceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	record.SpanID = "00f067aa0ba902b7"
+	record.InstanceID = "calculator-server-1"
+	record.ClientID = "10.0.0.7"
+	record.CacheHit = true
+	record.ComputeDuration = 1500 * time.Nanosecond
+	if err := s.Write(ctx, record); err != nil {
+		t.Fatalf("Write: %v", err)
+	}
+
+	history, err := s.GetHistory(ctx, 0)
+	if err != nil {
+		t.Fatalf("GetHistory: %v", err)
+	}
+	if len(history) != 1 {
+		t.Fatalf("GetHistory returned %d records, want 1", len(history))
+	}
+
+	got := history[0]
+	if got.TraceID != record.TraceID || got.SpanID != record.SpanID {
+		t.Errorf("record trace %s/%s, want %s/%s", got.TraceID, got.SpanID, record.TraceID, record.SpanID)
+	}
+	if got.InstanceID != record.InstanceID || got.ClientID != record.ClientID {
+		t.Errorf("record instance %q client %q, want %q and %q", got.InstanceID, got.ClientID, record.InstanceID, record.ClientID)
+	}
+	if !got.CacheHit {
+		t.Error("record CacheHit is false, want true")
+	}
+	if got.ComputeDuration != record.ComputeDuration {
+		t.Errorf("record ComputeDuration = %v, want %v", got.ComputeDuration, record.ComputeDuration)
+	}
+}
+
+func testByTraceID(t *testing.T, s storage.Storage) {
+	ctx := context.Background()
+	traces := []string{"4bf92f3577b34da6a3ce929d0e0e4736", "0af7651916cd43dd8448eb211c80319c"}
+	for i := range 6 {
+		record := newRecord(i, 1, i-1, "subtract")
+		record.TraceID = traces[i%2]
+		if err := s.Write(ctx, record); err != nil {
+			t.Fatalf("Write %d: %v", i, err)
+		}
+	}
+
+	history, err := s.GetHistoryByTraceID(ctx, traces[0])
+	if err != nil {
+		t.Fatalf("GetHistoryByTraceID: %v", err)
+	}
+	if len(history) != 3 {
+		t.Fatalf("GetHistoryByTraceID returned %d records, want 3", len(history))
+	}
+	for i, record := range history {
+		if record.TraceID != traces[0] {
+			t.Errorf("record %d has trace ID %s, want %s", i, record.TraceID, traces[0])
+		}
+		if want := 4 - 2*i; record.Input1 != want {
+			t.Errorf("record %d has input1 %d, want %d", i, record.Input1, want)
+		}
+	}
+
+	history, err = s.GetHistoryByTraceID(ctx, "ffffffffffffffffffffffffffffffff")
+	if err != nil {
+		t.Fatalf("GetHistoryByTraceID: %v", err)
+	}
+	if len(history) != 0 {
+		t.Errorf("GetHistoryByTraceID for an unknown trace returned %d records", len(history))
+	}
+}
@@ -0,0 +1,23 @@
+package storage
+
+import (
+	"context"
+
+	"go.opentelemetry.io/otel/attribute"
+	semconv "go.opentelemetry.io/otel/semconv/v1.32.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// historyTable holds the calculation history in the SQL backends.
+const historyTable = "calculator_history"
+
+// annotateSpan describes the database operation on the span in ctx, normally
+// the history span the service starts around each read and write. The SQL
+// statements themselves are traced by otelsql as child spans.
+func annotateSpan(ctx context.Context, system attribute.KeyValue, operation string, attrs ...attribute.KeyValue) {
+	trace.SpanFromContext(ctx).SetAttributes(append(attrs,
+		system,
+		semconv.DBCollectionName(historyTable),
+		semconv.DBOperationName(operation),
+	)...)
+}
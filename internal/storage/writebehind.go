@@ -0,0 +1,270 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"calculator-otel/internal/logger"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+)
+
+// ErrQueueClosed is returned by WriteBehind.Write once the queue is draining.
+var ErrQueueClosed = errors.New("history queue is closed")
+
+// OverflowPolicy decides what happens to a record written while the queue is
+// full.
+type OverflowPolicy string
+
+const (
+	// OverflowBlock makes the writer wait for room in the queue.
+	OverflowBlock OverflowPolicy = "block"
+	// OverflowDrop discards the record.
+	OverflowDrop OverflowPolicy = "drop"
+	// OverflowSpill appends the record to the history journal, from which it
+	// is replayed later.
+	OverflowSpill OverflowPolicy = "spill"
+)
+
+type WriteBehindConfig struct {
+	// QueueSize is the number of records buffered in memory.
+	QueueSize int
+	// BatchSize flushes the pending records once this many are queued.
+	BatchSize int
+	// FlushInterval flushes pending records at least this often.
+	FlushInterval time.Duration
+	// FlushTimeout bounds a single flush.
+	FlushTimeout time.Duration
+	// FlushRetries is how many times a batch that failed to flush is retried,
+	// with exponential backoff, before it is given up. A batch is only
+	// retried when there is no journal to append it to.
+	FlushRetries int
+	Overflow     OverflowPolicy
+	// Journal receives the records spilled by OverflowSpill and the batches
+	// that failed to flush, so that they are replayed later.
+	Journal *Journal
+}
+
+// WriteBehind is a Storage that queues writes in memory and flushes them to
+// the underlying storage in batches, taking the database round trip out of
+// the request path. Reads go straight to the underlying storage, so records
+// still in the queue are not visible yet.
+type WriteBehind struct {
+	next   Storage
+	config WriteBehindConfig
+	logger logger.Logger
+
+	mu     sync.RWMutex
+	closed bool
+	queue  chan *HistoryRecord
+	done   chan struct{}
+
+	flushDuration metric.Float64Histogram
+	flushed       metric.Int64Counter
+	overflowed    metric.Int64Counter
+}
+
+// NewWriteBehind starts the background flusher for next.
+func NewWriteBehind(next Storage, config WriteBehindConfig, logger logger.Logger, meter metric.Meter) (*WriteBehind, error) {
+	if config.QueueSize <= 0 {
+		config.QueueSize = 10_000
+	}
+	if config.BatchSize <= 0 {
+		config.BatchSize = 500
+	}
+	if config.FlushInterval <= 0 {
+		config.FlushInterval = 200 * time.Millisecond
+	}
+	if config.FlushTimeout <= 0 {
+		config.FlushTimeout = 10 * time.Second
+	}
+	if config.FlushRetries <= 0 {
+		config.FlushRetries = 5
+	}
+	switch config.Overflow {
+	case OverflowBlock, OverflowDrop:
+	case OverflowSpill:
+		if config.Journal == nil {
+			return nil, fmt.Errorf("spill overflow requires a history journal")
+		}
+	default:
+		return nil, fmt.Errorf("unknown overflow policy %q", config.Overflow)
+	}
+
+	w := &WriteBehind{
+		next:   next,
+		config: config,
+		logger: logger,
+		queue:  make(chan *HistoryRecord, config.QueueSize),
+		done:   make(chan struct{}),
+	}
+
+	var err error
+	if w.flushDuration, err = meter.Float64Histogram("history.flush.duration",
+		metric.WithUnit("s"), metric.WithDescription("Time taken to flush a batch of history records")); err != nil {
+		return nil, err
+	}
+	if w.flushed, err = meter.Int64Counter("history.flush.records",
+		metric.WithUnit("{record}"), metric.WithDescription("History records flushed, by outcome")); err != nil {
+		return nil, err
+	}
+	if w.overflowed, err = meter.Int64Counter("history.queue.overflow",
+		metric.WithUnit("{record}"), metric.WithDescription("History records that did not fit in the queue, by overflow policy")); err != nil {
+		return nil, err
+	}
+	if _, err = meter.Int64ObservableGauge("history.queue.depth",
+		metric.WithUnit("{record}"), metric.WithDescription("History records waiting to be flushed"),
+		metric.WithInt64Callback(func(_ context.Context, o metric.Int64Observer) error {
+			o.Observe(int64(len(w.queue)))
+			return nil
+		})); err != nil {
+		return nil, err
+	}
+
+	go w.run()
+
+	return w, nil
+}
+
+func (w *WriteBehind) Write(ctx context.Context, record *HistoryRecord) error {
+	w.mu.RLock()
+	defer w.mu.RUnlock()
+
+	if w.closed {
+		return ErrQueueClosed
+	}
+
+	select {
+	case w.queue <- record:
+		return nil
+	default:
+	}
+
+	w.overflowed.Add(ctx, 1, metric.WithAttributes(attribute.String("policy", string(w.config.Overflow))))
+
+	switch w.config.Overflow {
+	case OverflowBlock:
+		select {
+		case w.queue <- record:
+			return nil
+		case <-ctx.Done():
+			return fmt.Errorf("history queue is full: %w", ctx.Err())
+		}
+	case OverflowSpill:
+		if err := w.config.Journal.Append(record); err != nil {
+			return fmt.Errorf("history queue is full and spilling failed: %w", err)
+		}
+		return nil
+	default:
+		w.logger.WarnContext(ctx, "history queue is full, dropping record", "calculator.operation", record.Operation)
+		return nil
+	}
+}
+
+func (w *WriteBehind) GetHistory(ctx context.Context, limit int) ([]*HistoryRecord, error) {
+	return w.next.GetHistory(ctx, limit)
+}
+
+func (w *WriteBehind) GetHistoryByTraceID(ctx context.Context, traceID string) ([]*HistoryRecord, error) {
+	return w.next.GetHistoryByTraceID(ctx, traceID)
+}
+
+// Close stops accepting writes and flushes everything still queued. It
+// returns early if ctx is done first.
+func (w *WriteBehind) Close(ctx context.Context) error {
+	w.mu.Lock()
+	if !w.closed {
+		w.closed = true
+		close(w.queue)
+	}
+	w.mu.Unlock()
+
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("history queue not drained, %d records left: %w", len(w.queue), ctx.Err())
+	}
+}
+
+func (w *WriteBehind) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.config.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]*HistoryRecord, 0, w.config.BatchSize)
+	for {
+		select {
+		case record, ok := <-w.queue:
+			if !ok {
+				w.flush(batch)
+				return
+			}
+			batch = append(batch, record)
+			if len(batch) >= w.config.BatchSize {
+				w.flush(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				w.flush(batch)
+				batch = batch[:0]
+			}
+		}
+	}
+}
+
+// flush writes batch to the underlying storage. A batch that fails is
+// appended to the journal when there is one, and retried with exponential
+// backoff otherwise.
+func (w *WriteBehind) flush(batch []*HistoryRecord) {
+	if len(batch) == 0 {
+		return
+	}
+
+	ctx := context.Background()
+	backoff := 100 * time.Millisecond
+	for attempt := 1; ; attempt++ {
+		err := w.flushOnce(batch)
+		if err == nil {
+			w.flushed.Add(ctx, int64(len(batch)), metric.WithAttributes(attribute.String("outcome", "success")))
+			return
+		}
+
+		if w.config.Journal != nil {
+			journalErr := w.config.Journal.Append(batch...)
+			if journalErr == nil {
+				w.flushed.Add(ctx, int64(len(batch)), metric.WithAttributes(attribute.String("outcome", "journaled")))
+				w.logger.WarnContext(ctx, "failed to flush history batch, records journaled for replay", "error", err, "records", len(batch))
+				return
+			}
+			err = errors.Join(err, journalErr)
+		}
+
+		if attempt > w.config.FlushRetries {
+			w.flushed.Add(ctx, int64(len(batch)), metric.WithAttributes(attribute.String("outcome", "failure")))
+			w.logger.ErrorContext(ctx, "failed to flush history batch, records dropped", "error", err, "records", len(batch), "attempts", attempt)
+			return
+		}
+
+		w.logger.WarnContext(ctx, "failed to flush history batch, will retry", "error", err, "records", len(batch), "backoff", backoff)
+		time.Sleep(backoff)
+		backoff = min(backoff*2, 5*time.Second)
+	}
+}
+
+func (w *WriteBehind) flushOnce(batch []*HistoryRecord) error {
+	ctx, cancel := context.WithTimeout(context.Background(), w.config.FlushTimeout)
+	defer cancel()
+
+	start := time.Now()
+	err := writeBatch(ctx, w.next, batch)
+	w.flushDuration.Record(ctx, time.Since(start).Seconds())
+
+	return err
+}
@@ -0,0 +1,16 @@
+#!/bin/bash
+# Clones the primary with pg_basebackup on first start, then runs PostgreSQL
+# as a hot standby streaming from it.
+set -e
+
+if [ ! -s "$PGDATA/PG_VERSION" ]; then
+	until pg_basebackup --host=postgres --username=replicator --pgdata="$PGDATA" \
+		--wal-method=stream --write-recovery-conf --checkpoint=fast; do
+		echo "waiting for the primary to accept replication connections"
+		rm -rf "${PGDATA:?}"/*
+		sleep 2
+	done
+	chmod 0700 "$PGDATA"
+fi
+
+exec postgres -c hot_standby=on